@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/mattn/go-runewidth"
+)
+
+// Bookmarks are keyed by message sequence number rather than buffer index,
+// so they keep pointing at the same message when older messages are dropped.
+
+// selectedMessageSeq returns the sequence number of the selected message
+func (ui *UI) selectedMessageSeq() (uint64, bool) {
+	if ui.selectedMessage < 0 || ui.selectedMessage >= len(ui.messages) {
+		return 0, false
+	}
+	return ui.messages[ui.selectedMessage].Seq, true
+}
+
+// toggleBookmark bookmarks the selected message, or removes its bookmark
+func (ui *UI) toggleBookmark() {
+	seq, ok := ui.selectedMessageSeq()
+	if !ok {
+		return
+	}
+	if _, marked := ui.bookmarks[seq]; marked {
+		delete(ui.bookmarks, seq)
+	} else {
+		ui.bookmarks[seq] = ""
+	}
+}
+
+// setBookmarkNote bookmarks the selected message with a note
+func (ui *UI) setBookmarkNote(note string) {
+	if seq, ok := ui.selectedMessageSeq(); ok {
+		ui.bookmarks[seq] = strings.TrimSpace(note)
+	}
+}
+
+// bookmarkedSeqs returns the bookmarked sequence numbers in message order
+func (ui *UI) bookmarkedSeqs() []uint64 {
+	seqs := make([]uint64, 0, len(ui.bookmarks))
+	for seq := range ui.bookmarks {
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	return seqs
+}
+
+// messageIndex returns the buffer index of the message with a sequence number
+func (ui *UI) messageIndex(seq uint64) (int, bool) {
+	i := sort.Search(len(ui.messages), func(i int) bool { return ui.messages[i].Seq >= seq })
+	if i < len(ui.messages) && ui.messages[i].Seq == seq {
+		return i, true
+	}
+	return 0, false
+}
+
+// jumpToBookmark selects the next (dir > 0) or previous (dir < 0) bookmarked
+// message relative to the current selection
+func (ui *UI) jumpToBookmark(dir int) {
+	current, _ := ui.selectedMessageSeq()
+	seqs := ui.bookmarkedSeqs()
+	if dir < 0 {
+		for i := len(seqs) - 1; i >= 0; i-- {
+			if seqs[i] < current {
+				ui.selectMessageSeq(seqs[i])
+				return
+			}
+		}
+		return
+	}
+	for _, seq := range seqs {
+		if seq > current {
+			ui.selectMessageSeq(seq)
+			return
+		}
+	}
+}
+
+// selectMessageSeq selects the message with a sequence number, if still buffered
+func (ui *UI) selectMessageSeq(seq uint64) {
+	if i, ok := ui.messageIndex(seq); ok {
+		ui.selectedMessage = i
+	}
+}
+
+// pruneBookmarks drops bookmarks whose messages are no longer buffered
+func (ui *UI) pruneBookmarks() {
+	for seq := range ui.bookmarks {
+		if _, ok := ui.messageIndex(seq); !ok {
+			delete(ui.bookmarks, seq)
+		}
+	}
+	if ui.selectedBookmark >= len(ui.bookmarks) {
+		ui.selectedBookmark = len(ui.bookmarks) - 1
+	}
+	if ui.selectedBookmark < 0 {
+		ui.selectedBookmark = 0
+	}
+}
+
+// openSelectedBookmark jumps to the bookmark selected in the bookmarks list
+func (ui *UI) openSelectedBookmark() {
+	seqs := ui.bookmarkedSeqs()
+	if ui.selectedBookmark < len(seqs) {
+		ui.selectMessageSeq(seqs[ui.selectedBookmark])
+	}
+	ui.showBookmarks = false
+}
+
+// renderBookmarksPane renders the bookmarks list in place of the messages pane
+func (ui *UI) renderBookmarksPane(width, height int) string {
+	seqs := ui.bookmarkedSeqs()
+	title := fmt.Sprintf("Bookmarks (%d)", len(seqs))
+
+	// Scroll so the selected bookmark stays visible
+	availableLines := height - 3
+	if availableLines < 1 {
+		availableLines = 1
+	}
+	start := 0
+	if ui.selectedBookmark >= availableLines {
+		start = ui.selectedBookmark - availableLines + 1
+	}
+	end := start + availableLines
+	if end > len(seqs) {
+		end = len(seqs)
+	}
+
+	var items []string
+	if len(seqs) == 0 {
+		items = append(items, ui.styles.UnselectedItem.Render("No bookmarks yet... (b on a message)"))
+	}
+	for i := start; i < end; i++ {
+		seq := seqs[i]
+		idx, _ := ui.messageIndex(seq)
+		msg := ui.messages[idx]
+		item := fmt.Sprintf("★ %s %s", ui.formatTime(msg.Timestamp), msg.Topic)
+		if note := ui.bookmarks[seq]; note != "" {
+			item += " — " + note
+		}
+		item = runewidth.Truncate(item, width-2, "…")
+		if i == ui.selectedBookmark {
+			item = ui.styles.SelectedItem.Width(width).Render(item)
+		} else {
+			item = ui.styles.UnselectedItem.Render(item)
+		}
+		items = append(items, item)
+	}
+
+	style := ui.styles.InactivePane
+	if ui.activePane == MessagesPane {
+		style = ui.styles.ActivePane
+		title = ui.activeTitle(title)
+	}
+
+	return style.
+		Width(width).
+		Height(height).
+		Render(lipgloss.JoinVertical(
+			lipgloss.Left,
+			ui.styles.Title.Render(title),
+			strings.Join(items, "\n"),
+		))
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Bridge republishes messages matching a topic filter to a second broker,
+// or to a different topic prefix on the same broker
+type Bridge struct {
+	filter   string
+	prefix   string
+	client   mqtt.Client
+	separate bool
+	inFlight *inFlightTracker
+}
+
+// NewBridge creates a bridge from the bridge settings in config. Without a
+// bridge broker, messages are republished on the source broker's client,
+// which then requires a prefix so forwarded messages can't loop.
+func NewBridge(config Config, source mqtt.Client, inFlight *inFlightTracker) (*Bridge, error) {
+	bridge := &Bridge{
+		filter:   config.BridgeFilter,
+		prefix:   config.BridgePrefix,
+		client:   source,
+		inFlight: inFlight,
+	}
+
+	if config.BridgeBroker == "" {
+		if bridge.prefix == "" {
+			return nil, fmt.Errorf("bridging to the same broker requires MQTT_BRIDGE_PREFIX")
+		}
+		return bridge, nil
+	}
+
+	opts := mqtt.NewClientOptions()
+	opts.AddBroker(config.BridgeBroker)
+	opts.SetClientID(config.ClientID + "-bridge")
+	if isTLSBroker(config.BridgeBroker) {
+		tlsConfig, err := newTLSConfig(config)
+		if err != nil {
+			return nil, err
+		}
+		opts.SetTLSConfig(tlsConfig)
+	}
+	if config.Username != "" {
+		opts.SetUsername(config.Username)
+	}
+	if config.Password != "" {
+		opts.SetPassword(config.Password)
+	}
+	bridge.client = mqtt.NewClient(opts)
+	bridge.separate = true
+
+	return bridge, nil
+}
+
+// ConnectCmd returns a command connecting the bridge's destination broker
+func (b *Bridge) ConnectCmd() tea.Cmd {
+	return func() tea.Msg {
+		if !b.separate {
+			return nil
+		}
+		if token := b.client.Connect(); token.Wait() && token.Error() != nil {
+			return MQTTErrorMsg{Error: fmt.Errorf("bridge connect failed: %v", token.Error())}
+		}
+		return nil
+	}
+}
+
+// Forward republishes a message if it matches the bridge filter
+func (b *Bridge) Forward(msg mqtt.Message) {
+	topic := msg.Topic()
+	if !topicMatches(b.filter, topic) {
+		return
+	}
+	// Don't forward our own forwarded messages on the same broker
+	if !b.separate && strings.HasPrefix(topic, b.prefix) {
+		return
+	}
+	if !b.client.IsConnected() {
+		return
+	}
+
+	// Publishing from paho's callback goroutine must not wait on the token
+	token := b.client.Publish(b.prefix+topic, msg.Qos(), msg.Retained(), msg.Payload())
+	b.inFlight.track(token, func(err error) {
+		if err != nil {
+			logError("Bridge failed to forward %s: %v", topic, err)
+		}
+	})
+}
+
+// Disconnect disconnects the bridge's destination broker, giving it quiesce
+// to finish outstanding work
+func (b *Bridge) Disconnect(quiesce time.Duration) {
+	if b.separate {
+		b.client.Disconnect(uint(quiesce.Milliseconds()))
+	}
+}
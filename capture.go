@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Capture files hold raw MQTT messages for high-fidelity replay. After an
+// 8-byte magic header, each record is laid out big-endian as:
+//
+//	int64   timestamp (Unix nanoseconds)
+//	uint8   QoS
+//	uint8   flags (bit 0: retained)
+//	uint16  topic length, followed by the topic bytes
+//	uint32  payload length, followed by the raw payload bytes
+const captureMagic = "MQTTCAP1"
+
+// maxReplayGap caps the pause between replayed messages so long idle
+// stretches in a capture don't stall the replay
+const maxReplayGap = 2 * time.Second
+
+const captureFlagRetained = 1 << 0
+
+// CaptureRecord is a single captured message
+type CaptureRecord struct {
+	Topic     string
+	Payload   []byte
+	QoS       byte
+	Retained  bool
+	Timestamp time.Time
+}
+
+// CaptureWriter appends records to a capture stream
+type CaptureWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewCaptureWriter writes the capture header and returns a writer for records
+func NewCaptureWriter(w io.Writer) (*CaptureWriter, error) {
+	if _, err := io.WriteString(w, captureMagic); err != nil {
+		return nil, err
+	}
+	return &CaptureWriter{w: w}, nil
+}
+
+// Write appends a record. It is safe to call from multiple goroutines.
+func (c *CaptureWriter) Write(rec CaptureRecord) error {
+	if len(rec.Topic) > 0xFFFF {
+		return fmt.Errorf("topic too long for capture: %d bytes", len(rec.Topic))
+	}
+
+	buf := make([]byte, 0, 16+len(rec.Topic)+len(rec.Payload))
+	buf = binary.BigEndian.AppendUint64(buf, uint64(rec.Timestamp.UnixNano()))
+	buf = append(buf, rec.QoS)
+	var flags byte
+	if rec.Retained {
+		flags |= captureFlagRetained
+	}
+	buf = append(buf, flags)
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(rec.Topic)))
+	buf = append(buf, rec.Topic...)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(rec.Payload)))
+	buf = append(buf, rec.Payload...)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := c.w.Write(buf)
+	return err
+}
+
+// CaptureReader reads records from a capture stream
+type CaptureReader struct {
+	r *bufio.Reader
+}
+
+// NewCaptureReader checks the capture header and returns a reader for records
+func NewCaptureReader(r io.Reader) (*CaptureReader, error) {
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(captureMagic))
+	if _, err := io.ReadFull(br, magic); err != nil {
+		return nil, fmt.Errorf("reading capture header: %v", err)
+	}
+	if string(magic) != captureMagic {
+		return nil, errors.New("not an mqttui capture file")
+	}
+	return &CaptureReader{r: br}, nil
+}
+
+// Next returns the next record, or io.EOF when the capture is exhausted
+func (c *CaptureReader) Next() (CaptureRecord, error) {
+	var header [12]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		if err == io.EOF {
+			return CaptureRecord{}, io.EOF
+		}
+		return CaptureRecord{}, fmt.Errorf("truncated capture record: %v", err)
+	}
+
+	rec := CaptureRecord{
+		Timestamp: time.Unix(0, int64(binary.BigEndian.Uint64(header[0:8]))),
+		QoS:       header[8],
+		Retained:  header[9]&captureFlagRetained != 0,
+	}
+
+	topic := make([]byte, binary.BigEndian.Uint16(header[10:12]))
+	if _, err := io.ReadFull(c.r, topic); err != nil {
+		return CaptureRecord{}, fmt.Errorf("truncated capture topic: %v", err)
+	}
+	rec.Topic = string(topic)
+
+	var size [4]byte
+	if _, err := io.ReadFull(c.r, size[:]); err != nil {
+		return CaptureRecord{}, fmt.Errorf("truncated capture record: %v", err)
+	}
+	rec.Payload = make([]byte, binary.BigEndian.Uint32(size[:]))
+	if _, err := io.ReadFull(c.r, rec.Payload); err != nil {
+		return CaptureRecord{}, fmt.Errorf("truncated capture payload: %v", err)
+	}
+
+	return rec, nil
+}
+
+// ReplayRecordMsg delivers a replayed record to the application
+type ReplayRecordMsg struct {
+	Record CaptureRecord
+}
+
+// ReplayDoneMsg signals the end of a replay
+type ReplayDoneMsg struct {
+	Count int
+}
+
+// Replayer feeds a capture file back into the UI at its original pace
+type Replayer struct {
+	file   *os.File
+	reader *CaptureReader
+	last   time.Time
+	count  int
+}
+
+// OpenReplay opens a capture file for replay
+func OpenReplay(path string) (*Replayer, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := NewCaptureReader(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return &Replayer{file: file, reader: reader}, nil
+}
+
+// NextCmd returns a command that waits out the original gap before the next
+// record and delivers it
+func (r *Replayer) NextCmd() tea.Cmd {
+	return func() tea.Msg {
+		rec, err := r.reader.Next()
+		if err == io.EOF {
+			r.file.Close()
+			return ReplayDoneMsg{Count: r.count}
+		}
+		if err != nil {
+			r.file.Close()
+			return MQTTErrorMsg{Error: fmt.Errorf("replay stopped: %v", err)}
+		}
+
+		if !r.last.IsZero() {
+			gap := rec.Timestamp.Sub(r.last)
+			if gap > maxReplayGap {
+				gap = maxReplayGap
+			}
+			if gap > 0 {
+				time.Sleep(gap)
+			}
+		}
+		r.last = rec.Timestamp
+		r.count++
+
+		return ReplayRecordMsg{Record: rec}
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// brailleDots maps a dot position within a braille cell, [x][y] with y
+// counted from the top, to its bit in the braille block
+var brailleDots = [2][4]rune{
+	{0x01, 0x02, 0x04, 0x40},
+	{0x08, 0x10, 0x20, 0x80},
+}
+
+// chartLabelWidth fits any value rendered by formatValue
+const chartLabelWidth = 12
+
+// numericValues parses the payloads of the given messages as numbers,
+// skipping the ones that aren't
+func numericValues(msgs []Message) []float64 {
+	var values []float64
+	for _, msg := range msgs {
+		if value, ok := parseNumber(displayPayload(msg)); ok {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// brailleChart plots values as a line on a width x height grid of braille
+// cells, two points per column and four dots per row, scaled between lo and hi
+func brailleChart(values []float64, width, height int, lo, hi float64) []string {
+	grid := make([][]rune, height)
+	for i := range grid {
+		grid[i] = make([]rune, width)
+	}
+
+	dotsHigh := height * 4
+	plot := func(x, y int) {
+		// y counts dots from the bottom
+		row := height - 1 - y/4
+		grid[row][x/2] |= brailleDots[x%2][3-y%4]
+	}
+	scale := func(value float64) int {
+		if hi == lo {
+			return dotsHigh / 2
+		}
+		return int(math.Round((value - lo) / (hi - lo) * float64(dotsHigh-1)))
+	}
+
+	prev := -1
+	for x, value := range values {
+		y := scale(value)
+		// Fill the vertical gap to the previous point so the line is continuous
+		from, to := y, y
+		if prev >= 0 {
+			from, to = min(prev, y), max(prev, y)
+		}
+		for dot := from; dot <= to; dot++ {
+			plot(x, dot)
+		}
+		prev = y
+	}
+
+	lines := make([]string, height)
+	for i, row := range grid {
+		for j, cell := range row {
+			row[j] = 0x2800 + cell
+		}
+		lines[i] = string(row)
+	}
+	return lines
+}
+
+// renderChartPane renders a time-series chart of the chart topic's numeric
+// payloads in place of the messages pane
+func (ui *UI) renderChartPane(width, height int) string {
+	topic := ui.chartTopic
+	values := numericValues(ui.topicMessages(topic))
+
+	chartHeight := height - 5 // Title, topic and x-axis lines
+	if chartHeight < 2 {
+		chartHeight = 2
+	}
+
+	var lines []string
+	lines = append(lines, ui.styles.MessageTopic.Render(topic))
+	if len(values) == 0 {
+		lines = append(lines, "", ui.styles.Help.Render("No numeric payloads on this topic yet..."))
+	} else {
+		// The Y axis labels take a fixed column on the left
+		plotWidth := width - 4 - chartLabelWidth - 2
+		if plotWidth < 10 {
+			plotWidth = 10
+		}
+
+		// Show the most recent values that fit, two per column, and scale
+		// the Y axis to them
+		if len(values) > plotWidth*2 {
+			values = values[len(values)-plotWidth*2:]
+		}
+		lo, hi := values[0], values[0]
+		for _, value := range values {
+			lo, hi = math.Min(lo, value), math.Max(hi, value)
+		}
+		labels := []string{formatValue(hi), formatValue((lo + hi) / 2), formatValue(lo)}
+
+		for i, row := range brailleChart(values, plotWidth, chartHeight, lo, hi) {
+			label := ""
+			switch i {
+			case 0:
+				label = labels[0]
+			case chartHeight / 2:
+				label = labels[1]
+			case chartHeight - 1:
+				label = labels[2]
+			}
+			lines = append(lines, ui.styles.MessageTime.Render(fmt.Sprintf("%*s ┤", chartLabelWidth, label))+row)
+		}
+		lines = append(lines, ui.styles.Help.Render(fmt.Sprintf("%*s └ last %d values, latest %s",
+			chartLabelWidth, "", len(values), formatValue(values[len(values)-1]))))
+	}
+
+	title := "Chart"
+	style := ui.styles.InactivePane
+	if ui.activePane == MessagesPane {
+		style = ui.styles.ActivePane
+		title = ui.activeTitle(title)
+	}
+
+	return style.
+		Width(width).
+		Height(height).
+		Render(lipgloss.JoinVertical(
+			lipgloss.Left,
+			ui.styles.Title.Render(title),
+			strings.Join(lines, "\n"),
+		))
+}
+
+// formatValue renders a chart value compactly
+func formatValue(value float64) string {
+	return strconv.FormatFloat(value, 'g', 6, 64)
+}
+
+// maxTrendValues is how many recent numeric values a topic keeps for the
+// trend line in the inspector
+const maxTrendValues = 60
+
+// valueRing keeps the most recent numeric values received on a topic
+type valueRing struct {
+	values [maxTrendValues]float64
+	next   int
+	n      int
+}
+
+// add records a value, replacing the oldest once the ring is full
+func (r *valueRing) add(value float64) {
+	r.values[r.next] = value
+	r.next = (r.next + 1) % maxTrendValues
+	r.n = min(r.n+1, maxTrendValues)
+}
+
+// list returns the recorded values, oldest first
+func (r *valueRing) list() []float64 {
+	values := make([]float64, 0, r.n)
+	for k := range r.n {
+		values = append(values, r.values[(r.next-r.n+k+maxTrendValues)%maxTrendValues])
+	}
+	return values
+}
+
+// parseNumber parses a payload as a finite number
+func parseNumber(s string) (float64, bool) {
+	value, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, false
+	}
+	return value, true
+}
+
+// numericPayload returns the number a message carries: the value at the
+// JSON path when one is configured and numeric, else the payload itself
+func (ui *UI) numericPayload(msg Message) (float64, bool) {
+	if ui.jsonPath != nil {
+		if value, ok := parseNumber(extractJSONPath(msg.Payload, ui.jsonPath)); ok {
+			return value, true
+		}
+	}
+	return parseNumber(msg.Payload)
+}
+
+// valueSparkline draws values scaled between the lowest and highest of them
+func valueSparkline(values []float64) string {
+	lo, hi := slices.Min(values), slices.Max(values)
+	line := make([]rune, len(values))
+	for k, value := range values {
+		level := len(sparkLevels) / 2
+		if hi > lo {
+			level = int(math.Round((value - lo) / (hi - lo) * float64(len(sparkLevels)-1)))
+		}
+		line[k] = sparkLevels[level]
+	}
+	return string(line)
+}
+
+// valueTrend renders a topic's recent numeric values as a sparkline with
+// their range, or nothing until it has received two numbers
+func (ui *UI) valueTrend(topic string, width int) []string {
+	stats, ok := ui.topicStats[topic]
+	if !ok || stats.values.n < 2 {
+		return nil
+	}
+	values := stats.values.list()
+	if len(values) > width {
+		values = values[len(values)-width:]
+	}
+	return []string{
+		"",
+		fmt.Sprintf("Values (last %d):", len(values)),
+		ui.styles.ActiveItem.Render(valueSparkline(values)),
+		fmt.Sprintf("min %s  max %s  latest %s", formatValue(slices.Min(values)), formatValue(slices.Max(values)), formatValue(values[len(values)-1])),
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"syscall"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+// checkTimeout bounds each network step of the connection check
+const checkTimeout = 5 * time.Second
+
+// checkReport prints the outcome of each connection check step
+type checkReport struct {
+	out    io.Writer
+	failed bool
+}
+
+func (r *checkReport) ok(step, detail string) {
+	fmt.Fprintf(r.out, "ok    %-10s %s\n", step, detail)
+}
+
+func (r *checkReport) warn(step, detail string) {
+	fmt.Fprintf(r.out, "warn  %-10s %s\n", step, detail)
+}
+
+func (r *checkReport) fail(step string, err error) {
+	r.failed = true
+	fmt.Fprintf(r.out, "FAIL  %-10s %v\n", step, err)
+	if hint := diagnose(err); hint != "" {
+		fmt.Fprintf(r.out, "      %-10s %s\n", "", hint)
+	}
+}
+
+// runCheck connects to the configured broker, subscribes to a test topic and
+// round-trips a message through it, printing the result of each step instead
+// of starting the interface. It returns the process exit code.
+func runCheck(config Config, out io.Writer) int {
+	report := &checkReport{out: out}
+
+	// Only the connection is under test
+	config.CaptureFile = ""
+	config.BridgeFilter = ""
+	config.ClientID = expandClientID(config.ClientID)
+
+	for _, broker := range brokerURLs(config.BrokerURL) {
+		u, err := url.Parse(broker)
+		if err != nil {
+			report.fail("broker", fmt.Errorf("invalid broker URL %q: %v", broker, err))
+			continue
+		}
+		addrs, err := net.LookupHost(u.Hostname())
+		if err != nil {
+			report.fail("dns", err)
+			continue
+		}
+		report.ok("dns", fmt.Sprintf("%s resolves to %v", u.Hostname(), addrs))
+	}
+	if report.failed {
+		return 1
+	}
+
+	client, err := NewMQTTClient(config)
+	if err != nil {
+		report.fail("config", err)
+		return 1
+	}
+
+	started := time.Now()
+	if err := client.connect(); err != nil {
+		report.fail("connect", err)
+		return 1
+	}
+	defer client.client.Disconnect(uint(config.DisconnectQuiesce.Milliseconds()))
+	report.ok("connect", fmt.Sprintf("%s as %q in %v", client.Broker(), config.ClientID, time.Since(started).Round(time.Millisecond)))
+
+	// Subscribe to a test topic and publish to it to prove the round trip
+	topic := "mqttui/check/" + config.ClientID
+	received := make(chan struct{}, 1)
+	token := client.client.Subscribe(topic, 1, func(mqtt.Client, mqtt.Message) {
+		select {
+		case received <- struct{}{}:
+		default:
+		}
+	})
+	if !token.WaitTimeout(checkTimeout) {
+		report.fail("subscribe", fmt.Errorf("no SUBACK for %s within %v", topic, checkTimeout))
+		return 1
+	}
+	if token.Error() != nil {
+		report.fail("subscribe", token.Error())
+		return 1
+	}
+	if sub, ok := token.(subscribeResult); ok && sub.Result()[topic] == subackFailure {
+		report.fail("subscribe", fmt.Errorf("subscription to %s rejected by broker", topic))
+		return 1
+	}
+	report.ok("subscribe", topic)
+
+	// Brokers with read-only ACLs may refuse the publish, which isn't fatal
+	started = time.Now()
+	client.client.Publish(topic, 1, false, "mqttui connection check")
+	select {
+	case <-received:
+		report.ok("roundtrip", fmt.Sprintf("message echoed back in %v", time.Since(started).Round(time.Millisecond)))
+	case <-time.After(checkTimeout):
+		report.warn("roundtrip", fmt.Sprintf("published message not received within %v (publish ACLs?)", checkTimeout))
+	}
+	client.client.Unsubscribe(topic).WaitTimeout(checkTimeout)
+
+	return 0
+}
+
+// diagnose suggests the likely cause of a connection check failure
+func diagnose(err error) string {
+	var dnsErr *net.DNSError
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	var invalidCert x509.CertificateInvalidError
+	var recordHeader tls.RecordHeaderError
+
+	switch {
+	case errors.As(err, &dnsErr):
+		return "the broker host name does not resolve; check MQTT_BROKER"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "nothing is listening on that port; check the broker is running and the port in MQTT_BROKER"
+	case errors.As(err, &unknownAuthority):
+		return "TLS: the broker certificate is signed by an unknown authority"
+	case errors.As(err, &hostname):
+		return "TLS: the broker certificate does not match the host name"
+	case errors.As(err, &invalidCert):
+		return "TLS: the broker certificate is invalid or expired"
+	case errors.As(err, &recordHeader):
+		return "TLS: the broker did not answer with TLS; check the ssl:// or tcp:// scheme and port"
+	case errors.Is(err, packets.ErrorRefusedBadUsernameOrPassword), errors.Is(err, packets.ErrorRefusedNotAuthorised):
+		return "authentication failed; check MQTT_USERNAME and MQTT_PASSWORD"
+	case errors.Is(err, packets.ErrorRefusedIDRejected):
+		return "the broker rejected the client ID; check MQTT_CLIENT_ID"
+	case errors.Is(err, packets.ErrorRefusedBadProtocolVersion):
+		return "the broker does not support this MQTT protocol version"
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return "the connection timed out; check firewalls and the broker address"
+	}
+	return ""
+}
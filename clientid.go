@@ -0,0 +1,40 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"strings"
+)
+
+// expandClientID fills in a client ID template: {hostname} becomes this
+// machine's host name and each {rand} a short random suffix, so instances
+// started with the same settings don't knock each other off the broker
+func expandClientID(template string) string {
+	id := template
+	if strings.Contains(id, "{hostname}") {
+		host, err := os.Hostname()
+		if err != nil {
+			logError("Failed to get the host name for the client ID: %v", err)
+			host = "unknown"
+		}
+		id = strings.ReplaceAll(id, "{hostname}", host)
+	}
+	for strings.Contains(id, "{rand}") {
+		id = strings.Replace(id, "{rand}", randomSuffix(), 1)
+	}
+	return id
+}
+
+// randomSuffix returns six random hex digits
+func randomSuffix() string {
+	b := make([]byte, 3)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// changesEachRun reports whether a client ID template gives a different ID
+// on every run, which can't identify a persistent session
+func changesEachRun(template string) bool {
+	return strings.Contains(template, "{rand}")
+}
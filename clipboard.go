@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/atotto/clipboard"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// errNoClipboard explains a missing clipboard, typical of SSH sessions and
+// headless machines
+var errNoClipboard = errors.New("no clipboard available (install xclip, xsel or wl-clipboard)")
+
+// clipboardCopiedMsg reports the outcome of copying a payload
+type clipboardCopiedMsg struct {
+	Bytes int
+	Err   error
+}
+
+// copySelectedPayload copies the selected message's payload to the system
+// clipboard; the clipboard tools are run off the UI goroutine
+func (ui *UI) copySelectedPayload() tea.Cmd {
+	if ui.selectedMessage < 0 || ui.selectedMessage >= len(ui.messages) {
+		return nil
+	}
+	payload := ui.messages[ui.selectedMessage].Payload
+	return func() tea.Msg {
+		if clipboard.Unsupported {
+			return clipboardCopiedMsg{Err: errNoClipboard}
+		}
+		return clipboardCopiedMsg{Bytes: len(payload), Err: clipboard.WriteAll(payload)}
+	}
+}
+
+// copiedNotice shows the outcome of a copy
+func (ui *UI) copiedNotice(msg clipboardCopiedMsg) tea.Cmd {
+	if msg.Err != nil {
+		ui.SetError(fmt.Sprintf("Copy failed: %v", msg.Err))
+		return nil
+	}
+	return ui.FlashNotice(fmt.Sprintf("Copied %s to the clipboard", formatBytes(msg.Bytes)))
+}
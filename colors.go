@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// topicPalette is the set of colors topics are hashed onto
+var topicPalette = []string{"39", "42", "208", "170", "226", "81", "203", "141", "114", "215", "45", "177"}
+
+// TopicColorRule colors topics matching Pattern by the value of its first
+// capture group (or the whole match without groups); Colors pins colors for
+// specific values, other values are hashed onto the palette
+type TopicColorRule struct {
+	Pattern *regexp.Regexp
+	Colors  map[string]string
+}
+
+// parseTopicColors parses "regex" or "regex=value:color,value:color" entries
+// separated by semicolons, e.g. "^devices/([^/]+)/=boiler:196,pump:42"
+func parseTopicColors(spec string) ([]TopicColorRule, error) {
+	var rules []TopicColorRule
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		pattern, mapping, _ := strings.Cut(entry, "=")
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid topic color pattern %q: %v", pattern, err)
+		}
+
+		rule := TopicColorRule{Pattern: re, Colors: make(map[string]string)}
+		for _, pair := range strings.Split(mapping, ",") {
+			if strings.TrimSpace(pair) == "" {
+				continue
+			}
+			value, color, ok := strings.Cut(pair, ":")
+			if !ok || strings.TrimSpace(color) == "" {
+				return nil, fmt.Errorf("invalid topic color %q, expected value:color", pair)
+			}
+			rule.Colors[strings.TrimSpace(value)] = strings.TrimSpace(color)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// hashColor picks a stable palette color for a value
+func hashColor(value string) string {
+	h := fnv.New32a()
+	h.Write([]byte(value))
+	return topicPalette[h.Sum32()%uint32(len(topicPalette))]
+}
+
+// colorForTopic returns the color a topic is drawn in, from the first
+// matching color rule or else hashed from its top-level segment. Topics keep
+// the default style when no color rules are configured or in minimal mode.
+func (ui *UI) colorForTopic(topic string) (lipgloss.Color, bool) {
+	if len(ui.topicColorRules) == 0 || ui.noColor {
+		return "", false
+	}
+	if color, ok := ui.topicColors[topic]; ok {
+		return color, true
+	}
+
+	var color lipgloss.Color
+	for _, rule := range ui.topicColorRules {
+		match := rule.Pattern.FindStringSubmatch(topic)
+		if match == nil {
+			continue
+		}
+		value := match[0]
+		if len(match) > 1 {
+			value = match[1]
+		}
+		if pinned, ok := rule.Colors[value]; ok {
+			color = lipgloss.Color(pinned)
+		} else {
+			color = lipgloss.Color(hashColor(value))
+		}
+		break
+	}
+	if color == "" {
+		segment, _, _ := strings.Cut(topic, "/")
+		color = lipgloss.Color(hashColor(segment))
+	}
+
+	ui.topicColors[topic] = color
+	return color, true
+}
+
+// topicStyle returns the message topic style in the topic's color
+func (ui *UI) topicStyle(topic string) lipgloss.Style {
+	if color, ok := ui.colorForTopic(topic); ok {
+		return ui.styles.MessageTopic.Foreground(color)
+	}
+	return ui.styles.MessageTopic
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/mattn/go-runewidth"
+)
+
+// comparing reports whether two topics are pinned side by side
+func (ui *UI) comparing() bool {
+	return len(ui.compareTopics) == 2
+}
+
+// toggleCompareTopic pins the selected topic for comparison, or unpins it
+// when it is already pinned; pinning a third topic replaces the second
+func (ui *UI) toggleCompareTopic() {
+	topic, ok := ui.selectedTopicName()
+	if !ok {
+		return
+	}
+
+	for i, pinned := range ui.compareTopics {
+		if pinned == topic {
+			ui.compareTopics = append(ui.compareTopics[:i], ui.compareTopics[i+1:]...)
+			return
+		}
+	}
+	if len(ui.compareTopics) == 2 {
+		ui.compareTopics = ui.compareTopics[:1]
+	}
+	ui.compareTopics = append(ui.compareTopics, topic)
+	ui.compareScroll = 0
+
+	if ui.comparing() {
+		ui.SetNotice(fmt.Sprintf("Comparing %s and %s", ui.compareTopics[0], ui.compareTopics[1]))
+	} else {
+		ui.SetNotice(fmt.Sprintf("Pinned %s, pick a second topic with =", topic))
+	}
+}
+
+// compareColumn renders a topic's messages as lines for one compare column
+func (ui *UI) compareColumn(topic string, width int) []string {
+	var lines []string
+	for _, msg := range ui.topicMessages(topic) {
+		// Large payloads are cut to the preview limit like in the messages pane
+		preview, truncated := ui.previewPayload(msg)
+		lines = append(lines, ui.styles.MessageTime.Render(ui.formatTime(msg.Timestamp)))
+		lines = append(lines, ui.wrapText(sanitizePayload(displayPayload(preview)), width)...)
+		if truncated != "" {
+			lines = append(lines, ui.styles.MessageTime.Render(truncated))
+		}
+	}
+	return lines
+}
+
+// renderComparePane renders the two pinned topics side by side in place of
+// the messages pane, newest messages at the bottom
+func (ui *UI) renderComparePane(width, height int) string {
+	// Two columns separated by a divider inside the pane's padding and border
+	columnWidth := (width - 4 - 3) / 2
+	if columnWidth < 10 {
+		columnWidth = 10
+	}
+	availableLines := height - 4 // Title and column headers
+	if availableLines < 1 {
+		availableLines = 1
+	}
+
+	columns := make([][]string, 2)
+	maxScroll := 0
+	for i, topic := range ui.compareTopics {
+		columns[i] = ui.compareColumn(topic, columnWidth)
+		if extra := len(columns[i]) - availableLines; extra > maxScroll {
+			maxScroll = extra
+		}
+	}
+	if ui.compareScroll > maxScroll {
+		ui.compareScroll = maxScroll
+	}
+
+	// Scrolling moves both columns back in time by the same number of lines
+	rendered := make([]string, 2)
+	for i, topic := range ui.compareTopics {
+		lines := columns[i]
+		end := len(lines) - ui.compareScroll
+		if end < 0 {
+			end = 0
+		}
+		start := end - availableLines
+		if start < 0 {
+			start = 0
+		}
+		header := ui.topicStyle(topic).Render(runewidth.Truncate(topic, columnWidth, "…"))
+		body := lines[start:end]
+		if len(body) == 0 {
+			body = []string{ui.styles.Help.Render("No messages yet...")}
+		}
+		rendered[i] = lipgloss.NewStyle().
+			Width(columnWidth).
+			Render(header + "\n" + strings.Join(body, "\n"))
+	}
+
+	divider := strings.TrimSuffix(strings.Repeat(" │ \n", availableLines+1), "\n")
+	content := lipgloss.JoinHorizontal(lipgloss.Top, rendered[0], divider, rendered[1])
+
+	title := "Compare"
+	if ui.compareScroll > 0 {
+		title += " ↓"
+	}
+	if ui.compareScroll < maxScroll {
+		title += " ↑"
+	}
+
+	style := ui.styles.InactivePane
+	if ui.activePane == MessagesPane {
+		style = ui.styles.ActivePane
+		title = ui.activeTitle(title)
+	}
+
+	return style.
+		Width(width).
+		Height(height).
+		Render(lipgloss.JoinVertical(
+			lipgloss.Left,
+			ui.styles.Title.Render(title),
+			content,
+		))
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+)
+
+// maxDiffLines bounds the payload lines compared, as the line diff takes
+// time and memory proportional to the product of both sides
+const maxDiffLines = 2000
+
+// diffOp marks a line of a diff as kept, added or removed
+type diffOp byte
+
+const (
+	diffSame    diffOp = ' '
+	diffAdded   diffOp = '+'
+	diffRemoved diffOp = '-'
+)
+
+// diffLine is one line of a line diff
+type diffLine struct {
+	Op   diffOp
+	Text string
+}
+
+// diffLines computes a line diff turning a into b from their longest common
+// subsequence; a changed line shows as removed followed by added
+func diffLines(a, b []string) []diffLine {
+	// lcs[i][j] is the common subsequence length of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var lines []diffLine
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			lines = append(lines, diffLine{diffSame, a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, diffLine{diffRemoved, a[i]})
+			i++
+		default:
+			lines = append(lines, diffLine{diffAdded, b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		lines = append(lines, diffLine{diffRemoved, a[i]})
+	}
+	for ; j < len(b); j++ {
+		lines = append(lines, diffLine{diffAdded, b[j]})
+	}
+	return lines
+}
+
+// payloadDiffCache holds the diff last computed for the inspector, so the
+// LCS table isn't rebuilt on every render of the same pair
+type payloadDiffCache struct {
+	before, after uint64 // message sequence numbers
+	decoder       PayloadDecoder
+	lines         []diffLine
+	tooLong       bool
+}
+
+// cachedDiff returns the line diff between two buffered messages, computing
+// it only when the pair or the payload decoder changed
+func (ui *UI) cachedDiff(prev, i int) *payloadDiffCache {
+	before, after := ui.messages[prev], ui.messages[i]
+	if c := ui.diffCache; c != nil && c.before == before.Seq && c.after == after.Seq && c.decoder == ui.decoder {
+		return c
+	}
+	c := &payloadDiffCache{before: before.Seq, after: after.Seq, decoder: ui.decoder}
+	beforeLines, afterLines := ui.diffText(before), ui.diffText(after)
+	if len(beforeLines) > maxDiffLines || len(afterLines) > maxDiffLines {
+		c.tooLong = true
+	} else {
+		c.lines = diffLines(beforeLines, afterLines)
+	}
+	ui.diffCache = c
+	return c
+}
+
+// previousOnTopic returns the index of the buffered message received on the
+// same topic before the message at index i
+func (ui *UI) previousOnTopic(i int) (int, bool) {
+	for j := i - 1; j >= 0; j-- {
+		if ui.messages[j].Topic == ui.messages[i].Topic {
+			return j, true
+		}
+	}
+	return 0, false
+}
+
+// diffText returns a message's payload as the lines that are compared: JSON
+// pretty-printed so structural changes land on their own lines, binary
+// payloads as a hex dump
+func (ui *UI) diffText(msg Message) []string {
+	data, binary, _ := ui.decodedPayload(msg)
+	if binary {
+		return hexDump(data, 0)
+	}
+	text := string(data)
+	if pretty, ok := prettyJSON(text); ok {
+		text = pretty
+	} else {
+		text = sanitizePayload(text)
+	}
+	return strings.Split(strings.TrimRight(text, "\n"), "\n")
+}
+
+// payloadDiff renders the changes from the previous message on the topic
+// to the message at index i, fitting within width
+func (ui *UI) payloadDiff(i, width int) []string {
+	prev, ok := ui.previousOnTopic(i)
+	if !ok {
+		return []string{"", ui.styles.UnselectedItem.Render("No earlier message on this topic is buffered to compare with")}
+	}
+	diff := ui.cachedDiff(prev, i)
+	heading := fmt.Sprintf("Changes since %s:", ui.formatTime(ui.messages[prev].Timestamp))
+	if diff.tooLong {
+		return []string{"", heading, ui.styles.UnselectedItem.Render(fmt.Sprintf("Too long to compare (more than %d lines)", maxDiffLines))}
+	}
+
+	lines := []string{"", heading}
+	changed := false
+	for _, line := range diff.lines {
+		text := runewidth.Truncate(string(line.Op)+" "+line.Text, width-2, "…")
+		switch line.Op {
+		case diffAdded:
+			text = ui.styles.ActiveItem.Render(text)
+			changed = true
+		case diffRemoved:
+			text = ui.styles.Error.UnsetBold().Render(text)
+			changed = true
+		default:
+			text = ui.styles.UnselectedItem.Render(text)
+		}
+		lines = append(lines, text)
+	}
+	if !changed {
+		lines = append(lines, ui.styles.UnselectedItem.Render("(payload unchanged)"))
+	}
+	return lines
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/mattn/go-runewidth"
+)
+
+// maxErrorLog caps the error history shown with E
+const maxErrorLog = 50
+
+// errorDuration is how long an error stays on screen unless x dismisses it
+// sooner or another error replaces it
+const errorDuration = 8 * time.Second
+
+// ErrorEntry is an error in the error history
+type ErrorEntry struct {
+	At   time.Time
+	Text string
+}
+
+// expireErrorMsg clears the error line unless a newer error replaced it
+type expireErrorMsg struct {
+	id int
+}
+
+// SetError shows an error and records it in the error history; an empty
+// error clears the error line
+func (ui *UI) SetError(err string) {
+	ui.error = err
+	if err == "" {
+		return
+	}
+	ui.errorID++
+	ui.errorExpiry = true
+
+	// An error repeated while typing, say, counts once
+	if n := len(ui.errorLog); n > 0 && ui.errorLog[n-1].Text == err {
+		ui.errorLog[n-1].At = time.Now()
+		return
+	}
+	ui.errorLog = append(ui.errorLog, ErrorEntry{At: time.Now(), Text: err})
+	if len(ui.errorLog) > maxErrorLog {
+		ui.errorLog = ui.errorLog[len(ui.errorLog)-maxErrorLog:]
+	}
+}
+
+// TakeErrorExpiry returns the command that clears the error shown last
+// once errorDuration has passed, if it hasn't been scheduled yet
+func (ui *UI) TakeErrorExpiry() tea.Cmd {
+	if !ui.errorExpiry {
+		return nil
+	}
+	ui.errorExpiry = false
+	id := ui.errorID
+	return tea.Tick(errorDuration, func(time.Time) tea.Msg {
+		return expireErrorMsg{id: id}
+	})
+}
+
+// renderErrorsPane lists the recent errors, newest first
+func (ui *UI) renderErrorsPane(width, height int) string {
+	title := "Errors"
+	if len(ui.errorLog) > 0 {
+		title += fmt.Sprintf(" (%d)", len(ui.errorLog))
+	}
+	availableLines := max(height-3, 1)
+
+	var items []string
+	if len(ui.errorLog) == 0 {
+		items = append(items, ui.styles.UnselectedItem.Render("No errors"))
+	}
+	for i := len(ui.errorLog) - 1; i >= 0 && len(items) < availableLines; i-- {
+		entry := ui.errorLog[i]
+		item := runewidth.Truncate(ui.formatTime(entry.At)+" "+entry.Text, width-2, "…")
+		items = append(items, ui.styles.Error.UnsetBold().Render(item))
+	}
+
+	style := ui.styles.InactivePane
+	if ui.activePane == MessagesPane {
+		style = ui.styles.ActivePane
+		title = ui.activeTitle(title)
+	}
+
+	return style.
+		Width(width).
+		Height(height).
+		Render(lipgloss.JoinVertical(
+			lipgloss.Left,
+			ui.styles.Title.Render(title),
+			strings.Join(items, "\n"),
+		))
+}
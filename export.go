@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// exportRecord is one exported message in the JSON lines format
+type exportRecord struct {
+	Topic     string    `json:"topic"`
+	Timestamp time.Time `json:"timestamp"`
+	Payload   string    `json:"payload"`
+}
+
+// exportDoneMsg reports the outcome of an export
+type exportDoneMsg struct {
+	Path  string
+	Count int
+	Err   error
+}
+
+// exportFormat picks the export format from a file name: CSV for .csv,
+// JSON lines otherwise
+func exportFormat(path string) string {
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return "csv"
+	}
+	return "jsonl"
+}
+
+// ExportMessages writes messages as newline-delimited JSON ("jsonl") or as
+// CSV with a topic, timestamp, payload header ("csv")
+func ExportMessages(w io.Writer, format string, msgs []Message) error {
+	switch format {
+	case "jsonl":
+		enc := json.NewEncoder(w)
+		for _, msg := range msgs {
+			record := exportRecord{Topic: msg.Topic, Timestamp: msg.Timestamp, Payload: msg.Payload}
+			if err := enc.Encode(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "csv":
+		// The csv writer quotes fields containing commas, quotes or newlines
+		cw := csv.NewWriter(w)
+		if err := cw.Write([]string{"topic", "timestamp", "payload"}); err != nil {
+			return err
+		}
+		for _, msg := range msgs {
+			row := []string{msg.Topic, msg.Timestamp.Format(time.RFC3339Nano), msg.Payload}
+			if err := cw.Write(row); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+	return fmt.Errorf("unknown export format %q", format)
+}
+
+// exportMessagesCmd writes the messages passing the active filters to path
+func (ui *UI) exportMessagesCmd(path string) tea.Cmd {
+	visible := ui.visibleMessages()
+	msgs := make([]Message, len(visible))
+	for i, idx := range visible {
+		msgs[i] = ui.messages[idx]
+	}
+	return exportCmd(path, msgs)
+}
+
+// exportAllCmd writes every buffered message to path, whatever the filters
+func (ui *UI) exportAllCmd(path string) tea.Cmd {
+	return exportCmd(path, slices.Clone(ui.messages))
+}
+
+// exportCmd writes msgs to path in the format its extension selects
+func exportCmd(path string, msgs []Message) tea.Cmd {
+	return func() tea.Msg {
+		f, err := os.Create(path)
+		if err != nil {
+			return exportDoneMsg{Path: path, Err: err}
+		}
+		err = ExportMessages(f, exportFormat(path), msgs)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		return exportDoneMsg{Path: path, Count: len(msgs), Err: err}
+	}
+}
+
+// exportedNotice shows the outcome of an export
+func (ui *UI) exportedNotice(msg exportDoneMsg) tea.Cmd {
+	if msg.Err != nil {
+		ui.SetError(fmt.Sprintf("Export failed: %v", msg.Err))
+		return nil
+	}
+	return ui.FlashNotice(fmt.Sprintf("Exported %d messages to %s", msg.Count, msg.Path))
+}
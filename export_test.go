@@ -0,0 +1,104 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportMessages(t *testing.T) {
+	at := time.Date(2024, 3, 1, 12, 30, 45, 123000000, time.UTC)
+	tests := []struct {
+		name    string
+		format  string
+		msgs    []Message
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "jsonl one line per message",
+			format: "jsonl",
+			msgs: []Message{
+				{Topic: "home/temp", Payload: "21.5", Timestamp: at},
+				{Topic: "home/door", Payload: `{"open":true}`, Timestamp: at.Add(time.Second)},
+			},
+			want: `{"topic":"home/temp","timestamp":"2024-03-01T12:30:45.123Z","payload":"21.5"}` + "\n" +
+				`{"topic":"home/door","timestamp":"2024-03-01T12:30:46.123Z","payload":"{\"open\":true}"}` + "\n",
+		},
+		{
+			name:   "jsonl escapes newlines and NULs",
+			format: "jsonl",
+			msgs:   []Message{{Topic: "raw", Payload: "a\nb\x00", Timestamp: at}},
+			want:   `{"topic":"raw","timestamp":"2024-03-01T12:30:45.123Z","payload":"a\nb\u0000"}` + "\n",
+		},
+		{
+			name:   "jsonl without messages",
+			format: "jsonl",
+			want:   "",
+		},
+		{
+			name:   "csv with header",
+			format: "csv",
+			msgs: []Message{
+				{Topic: "home/temp", Payload: "21.5", Timestamp: at},
+			},
+			want: "topic,timestamp,payload\n" +
+				"home/temp,2024-03-01T12:30:45.123Z,21.5\n",
+		},
+		{
+			name:   "csv quotes commas, quotes and newlines",
+			format: "csv",
+			msgs: []Message{
+				{Topic: "a,b", Payload: `say "hi"`, Timestamp: at},
+				{Topic: "multi", Payload: "line1\nline2", Timestamp: at},
+			},
+			want: "topic,timestamp,payload\n" +
+				`"a,b",2024-03-01T12:30:45.123Z,"say ""hi"""` + "\n" +
+				"multi,2024-03-01T12:30:45.123Z,\"line1\nline2\"\n",
+		},
+		{
+			name:   "csv without messages keeps the header",
+			format: "csv",
+			want:   "topic,timestamp,payload\n",
+		},
+		{
+			name:    "unknown format",
+			format:  "xml",
+			msgs:    []Message{{Topic: "t", Payload: "p", Timestamp: at}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			err := ExportMessages(&out, tt.format, tt.msgs)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ExportMessages(%q) succeeded, want an error", tt.format)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("ExportMessages(%q) =\n%s\nwant\n%s", tt.format, out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestExportFormat(t *testing.T) {
+	tests := map[string]string{
+		"messages.csv":   "csv",
+		"MESSAGES.CSV":   "csv",
+		"messages.jsonl": "jsonl",
+		"messages":       "jsonl",
+		"dir.csv/out":    "jsonl",
+	}
+	for path, want := range tests {
+		if got := exportFormat(path); got != want {
+			t.Errorf("exportFormat(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+)
+
+// topicRegexpPrefix marks a topic filter as a regular expression
+const topicRegexpPrefix = "re:"
+
+// fieldFilterOps are the comparison operators of a field filter, two-character
+// operators first so ">=" isn't read as ">"
+var fieldFilterOps = []string{">=", "<=", "==", "!=", ">", "<"}
+
+// FieldFilter matches JSON payloads whose field at Path compares to Value,
+// e.g. `status == "error"` or `sensor.temp > 30`
+type FieldFilter struct {
+	Expr  string
+	Path  []string
+	Op    string
+	Value any
+}
+
+// parseFieldFilter parses "path op value". The path is dotted with array
+// indexes as numbers (readings.0.value); the value is a JSON literal, and a
+// bare word is taken as a string.
+func parseFieldFilter(expr string) (*FieldFilter, error) {
+	expr = strings.TrimSpace(expr)
+	opAt, op := -1, ""
+	for _, candidate := range fieldFilterOps {
+		if i := strings.Index(expr, candidate); i >= 0 && (opAt < 0 || i < opAt) {
+			opAt, op = i, candidate
+		}
+	}
+	if opAt < 0 {
+		return nil, fmt.Errorf("expected path, operator (%s) and value", strings.Join(fieldFilterOps, " "))
+	}
+
+	path := strings.TrimSpace(expr[:opAt])
+	raw := strings.TrimSpace(expr[opAt+len(op):])
+	if path == "" || raw == "" {
+		return nil, fmt.Errorf("expected path, operator (%s) and value", strings.Join(fieldFilterOps, " "))
+	}
+
+	var value any
+	if err := json.Unmarshal([]byte(raw), &value); err != nil {
+		value = raw
+	}
+	return &FieldFilter{
+		Expr:  expr,
+		Path:  strings.Split(path, "."),
+		Op:    op,
+		Value: value,
+	}, nil
+}
+
+// Match reports whether a payload is a JSON document whose field satisfies
+// the filter; non-JSON payloads and missing fields don't match
+func (f *FieldFilter) Match(payload string) bool {
+	var doc any
+	if err := json.Unmarshal([]byte(payload), &doc); err != nil {
+		return false
+	}
+	field, ok := lookupJSONPath(doc, f.Path)
+	if !ok {
+		return false
+	}
+
+	switch want := f.Value.(type) {
+	case float64:
+		if got, ok := field.(float64); ok {
+			return compareOrdered(got, want, f.Op)
+		}
+	case string:
+		if got, ok := field.(string); ok {
+			return compareOrdered(got, want, f.Op)
+		}
+	default:
+		// Booleans, null and composite values only support equality
+		equal := fmt.Sprint(field) == fmt.Sprint(want)
+		switch f.Op {
+		case "==":
+			return equal
+		case "!=":
+			return !equal
+		}
+	}
+	return false
+}
+
+// lookupJSONPath walks a decoded JSON document along a dotted path
+func lookupJSONPath(doc any, path []string) (any, bool) {
+	current := doc
+	for _, key := range path {
+		switch node := current.(type) {
+		case map[string]any:
+			value, ok := node[key]
+			if !ok {
+				return nil, false
+			}
+			current = value
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			current = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// missingJSONValue is shown for messages where the JSON path doesn't resolve
+const missingJSONValue = "—"
+
+// parseJSONPath splits a field selector such as ".temperature" or
+// "readings.0.value" into a path; a leading "$" or "." is optional. An empty
+// selector gives a nil path.
+func parseJSONPath(expr string) []string {
+	expr = strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(expr), "$"), ".")
+	if expr == "" {
+		return nil
+	}
+	return strings.Split(expr, ".")
+}
+
+// extractJSONPath returns the value at path in a JSON payload on one line:
+// strings as they are, anything else as JSON. Payloads that aren't JSON and
+// paths that don't resolve give missingJSONValue.
+func extractJSONPath(payload string, path []string) string {
+	var doc any
+	if err := json.Unmarshal([]byte(payload), &doc); err != nil {
+		return missingJSONValue
+	}
+	value, ok := lookupJSONPath(doc, path)
+	if !ok {
+		return missingJSONValue
+	}
+	if s, ok := value.(string); ok {
+		return strings.Join(strings.Fields(sanitizePayload(s)), " ")
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return missingJSONValue
+	}
+	return string(data)
+}
+
+// jsonPathValue returns the message's value at the configured JSON path,
+// truncated to width
+func (ui *UI) jsonPathValue(msg Message, width int) string {
+	return runewidth.Truncate(extractJSONPath(displayPayload(msg), ui.jsonPath), width, "…")
+}
+
+// compareOrdered applies a comparison operator to two ordered values
+func compareOrdered[T float64 | string](got, want T, op string) bool {
+	switch op {
+	case "==":
+		return got == want
+	case "!=":
+		return got != want
+	case ">":
+		return got > want
+	case ">=":
+		return got >= want
+	case "<":
+		return got < want
+	case "<=":
+		return got <= want
+	}
+	return false
+}
+
+// setFieldFilter applies a field filter expression to the messages pane, or
+// clears the filter when the expression is empty
+func (ui *UI) setFieldFilter(expr string) {
+	if strings.TrimSpace(expr) == "" {
+		ui.fieldFilter = nil
+	} else {
+		filter, err := parseFieldFilter(expr)
+		if err != nil {
+			ui.SetError(fmt.Sprintf("Filter: %v", err))
+			return
+		}
+		ui.fieldFilter = filter
+	}
+	ui.filterMatches = make(map[uint64]bool)
+	ui.invalidateSearch()
+	ui.scrollToLatest()
+}
+
+// messageVisible reports whether a message passes the active filters
+func (ui *UI) messageVisible(msg Message) bool {
+	// Messages received while paused wait for the resume
+	if ui.paused && msg.Seq > ui.pauseSeq {
+		return false
+	}
+	if ui.retainedOnly && !msg.Retained {
+		return false
+	}
+	if ui.fieldFilter == nil {
+		return true
+	}
+	// Parsing every payload on every frame is wasteful, so results are
+	// cached per message until the filter or the payload changes
+	match, ok := ui.filterMatches[msg.Seq]
+	if !ok {
+		match = ui.fieldFilter.Match(displayPayload(msg))
+		ui.filterMatches[msg.Seq] = match
+	}
+	return match
+}
+
+// visibleMessages returns the indexes of the messages passing the active filters
+func (ui *UI) visibleMessages() []int {
+	visible := make([]int, 0, len(ui.messages))
+	for i, msg := range ui.messages {
+		if ui.messageVisible(msg) {
+			visible = append(visible, i)
+		}
+	}
+	return visible
+}
+
+// nextVisibleMessage returns the index of the nearest visible message after
+// (dir > 0) or before (dir < 0) index i, or -1 when there is none
+func (ui *UI) nextVisibleMessage(i, dir int) int {
+	for i += dir; i >= 0 && i < len(ui.messages); i += dir {
+		if ui.messageVisible(ui.messages[i]) {
+			return i
+		}
+	}
+	return -1
+}
+
+// setTopicFilter narrows the topics pane to topics containing text
+// (case-insensitive), or matching the regular expression after a "re:"
+// prefix, keeping the selected topic selected when it still matches
+func (ui *UI) setTopicFilter(text string) {
+	keys := ui.topicKeys()
+	selected := ""
+	if ui.selectedTopic < len(keys) {
+		selected = keys[ui.selectedTopic]
+	}
+
+	ui.filter = text
+	ui.filterRegexp = nil
+	if strings.HasPrefix(ui.error, "Invalid regex") {
+		ui.SetError("")
+	}
+	if expr, ok := strings.CutPrefix(text, topicRegexpPrefix); ok {
+		// While a regex is half typed it doesn't compile; say why and
+		// leave the topics unfiltered until it does
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			ui.SetError(fmt.Sprintf("Invalid regex: %v", err))
+		} else {
+			ui.filterRegexp = re
+		}
+	}
+	ui.selectedTopic = 0
+	for i, key := range ui.topicKeys() {
+		if key == selected {
+			ui.selectedTopic = i
+			break
+		}
+	}
+}
+
+// filterTopics returns the topics matching the topic filter
+func (ui *UI) filterTopics(topics []string) []string {
+	if ui.filter == "" {
+		return topics
+	}
+	if strings.HasPrefix(ui.filter, topicRegexpPrefix) {
+		if ui.filterRegexp == nil {
+			return topics
+		}
+		var matched []string
+		for _, topic := range topics {
+			if ui.filterRegexp.MatchString(topic) {
+				matched = append(matched, topic)
+			}
+		}
+		return matched
+	}
+	needle := strings.ToLower(ui.filter)
+	var matched []string
+	for _, topic := range topics {
+		if strings.Contains(strings.ToLower(topic), needle) {
+			matched = append(matched, topic)
+		}
+	}
+	return matched
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+// headlessBuffer is how many received messages may wait to be written before
+// the MQTT client is held up
+const headlessBuffer = 1024
+
+// parseTopicList splits a comma-separated list of topic filters, skipping
+// empty entries and checking each filter's syntax
+func parseTopicList(list string) ([]string, error) {
+	var topics []string
+	for _, topic := range strings.Split(list, ",") {
+		topic = strings.TrimSpace(topic)
+		if topic == "" {
+			continue
+		}
+		if err := validateTopicFilter(topic); err != nil {
+			return nil, err
+		}
+		topics = append(topics, topic)
+	}
+	return topics, nil
+}
+
+// runHeadless subscribes to the configured topics, or # without any, and
+// writes every received message to out as a JSON line in the export format
+// until interrupted, without starting the interface. It returns the process
+// exit code.
+func runHeadless(config Config, out io.Writer) int {
+	topics := config.Topics
+	if len(topics) == 0 {
+		topics = []string{"#"}
+	}
+
+	// Log lines go to stderr unless a log file is set, keeping stdout clean
+	if config.LogFile != "" {
+		closeLog, err := setupLogging(config.LogFile, config.LogLevel)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Log file: %v\n", err)
+			return 1
+		}
+		defer closeLog()
+	} else {
+		logLevel = config.LogLevel
+	}
+
+	config.ClientID = expandClientID(config.ClientID)
+	client, err := NewMQTTClient(config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	messages := make(chan Message, headlessBuffer)
+	client.SetMessageSink(func(msg Message) { messages <- msg })
+
+	if err := client.connect(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer client.Disconnect()
+	for _, topic := range topics {
+		if err := client.SetSubscribed(topic, true, config.QoS); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: subscribing to %s: %v\n", topic, err)
+			return 1
+		}
+	}
+	logInfo("Writing messages on %s to stdout", strings.Join(topics, ", "))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return 0
+		case msg := <-messages:
+			// A closed pipe, say from head, ends the capture
+			if err := ExportMessages(out, "jsonl", []Message{msg}); err != nil {
+				logError("Writing message: %v", err)
+				return 1
+			}
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/mattn/go-runewidth"
+)
+
+// keyBinding is one line of the help overlay
+type keyBinding struct {
+	Keys   string
+	Action string
+}
+
+// keyGroup is a heading of the help overlay and the keys under it
+type keyGroup struct {
+	Name     string
+	Bindings []keyBinding
+}
+
+// keyGroups lists every key binding by where it applies
+var keyGroups = []keyGroup{
+	{"Global", []keyBinding{
+		{"?", "Show or hide this help"},
+		{"tab", "Switch between the topics and messages panes"},
+		{"↑/↓ k/j", "Move or scroll in the active pane"},
+		{"gg / G", "First or last topic, oldest or newest message"},
+		{"^d / ^u", "Half a page down or up"},
+		{"^f / ^b", "A full page down or up"},
+		{"/", "Filter topics, or search payloads in the messages pane"},
+		{"esc", "Clear the filter and close the open view"},
+		{"s", "Subscribe to a typed topic filter"},
+		{"A / U", "Subscribe to every listed topic / unsubscribe from all"},
+		{"M", "Toggle auto-subscribe to discovered topics"},
+		{"Q", "Cycle the QoS of new subscriptions"},
+		{"W", "Set the watch expression"},
+		{"C", "Toggle the columnar message layout"},
+		{"f", "Toggle pretty-printed JSON"},
+		{"X", "Cycle the payload decoder: text, hex, base64"},
+		{"m", "Toggle the QoS and retained badges"},
+		{"T", "Toggle messages grouped in threads per topic"},
+		{"P", "Pause or resume the messages pane"},
+		{"x / E", "Dismiss the error / list recent errors"},
+		{"e", "Export the messages passing the filters"},
+		{"r", "Reset messages"},
+		{"c", "Retry connecting"},
+		{"q / ^c", "Quit / quit without asking"},
+	}},
+	{"Topics pane", []keyBinding{
+		{"enter", "Subscribe or unsubscribe (branch/# on a tree branch)"},
+		{"w", "Subscribe to the topic's branch; again widens it"},
+		{"i", "Inspect the topic"},
+		{"t", "Chart the topic's numeric payloads"},
+		{"=", "Pin the topic for side-by-side comparison"},
+		{"o", "Toggle the topic tree (→/← expand, collapse)"},
+		{"l", "Toggle latest payload previews"},
+		{"S", "Toggle message counts and rates"},
+		{"v", "Toggle the subscriptions view"},
+		{"p", "Publish to the topic (@path sends a file)"},
+		{"d / D", "Remove the topic / clear all topics"},
+	}},
+	{"Messages pane", []keyBinding{
+		{"enter", "Inspect the message, or expand a thread"},
+		{"n / N", "Next or previous search match"},
+		{"I", "Toggle case-sensitive search"},
+		{"y", "Copy the payload"},
+		{"R", "Republish the message"},
+		{"F", "Filter by a JSON field expression"},
+		{"H", "Show only retained messages"},
+		{"b / a", "Bookmark the message / add a note"},
+		{"B", "List bookmarks"},
+		{"[ / ]", "Previous or next bookmark"},
+	}},
+	{"Message inspector", []keyBinding{
+		{"d", "Diff against the topic's previous message"},
+		{"↑/↓", "Scroll"},
+		{"esc", "Back to the messages"},
+	}},
+}
+
+// helpKeyWidth is the width of the keys column of the help overlay
+const helpKeyWidth = 10
+
+// helpColumnWidth is the width of one column of the help overlay
+const helpColumnWidth = 66
+
+// renderKeyGroups renders key groups as lines fitting within width
+func (ui *UI) renderKeyGroups(groups []keyGroup, width int) []string {
+	var lines []string
+	for i, group := range groups {
+		if i > 0 {
+			lines = append(lines, "")
+		}
+		lines = append(lines, ui.styles.Title.Render(group.Name))
+		for _, b := range group.Bindings {
+			keys := ui.styles.ActiveItem.Render(runewidth.FillRight(b.Keys, helpKeyWidth))
+			lines = append(lines, keys+runewidth.Truncate(b.Action, max(width-helpKeyWidth, 1), "…"))
+		}
+	}
+	return lines
+}
+
+// renderHelpOverlay renders the key reference over the whole screen, the
+// global keys beside the pane keys when the terminal is wide enough
+func (ui *UI) renderHelpOverlay() string {
+	width := ui.width - 4
+	var lines []string
+	if width >= 2*helpColumnWidth+2 {
+		left := strings.Join(ui.renderKeyGroups(keyGroups[:1], helpColumnWidth), "\n")
+		right := strings.Join(ui.renderKeyGroups(keyGroups[1:], helpColumnWidth), "\n")
+		joined := lipgloss.JoinHorizontal(lipgloss.Top, lipgloss.NewStyle().Width(helpColumnWidth+2).Render(left), right)
+		lines = strings.Split(joined, "\n")
+	} else {
+		lines = ui.renderKeyGroups(keyGroups, width)
+	}
+
+	// Scrolled like a pager, for terminals shorter than the list
+	availableLines := max(ui.height-3, 1)
+	ui.helpScroll = max(min(ui.helpScroll, len(lines)-availableLines), 0)
+	end := min(ui.helpScroll+availableLines, len(lines))
+
+	title := "Keyboard shortcuts (? or esc closes)"
+	if ui.helpScroll > 0 {
+		title += " ↑"
+	}
+	if end < len(lines) {
+		title += " ↓"
+	}
+	return ui.styles.ActivePane.
+		Width(ui.width - 2).
+		Height(ui.height - 2).
+		Render(lipgloss.JoinVertical(
+			lipgloss.Left,
+			ui.styles.Title.Render(title),
+			strings.Join(lines[ui.helpScroll:end], "\n"),
+		))
+}
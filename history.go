@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// maxRecentBrokers caps the recent brokers history
+const maxRecentBrokers = 10
+
+// RecentBroker is a previously used broker. Passwords are never stored.
+type RecentBroker struct {
+	BrokerURL string    `json:"broker_url"`
+	Username  string    `json:"username,omitempty"`
+	ClientID  string    `json:"client_id,omitempty"`
+	LastUsed  time.Time `json:"last_used"`
+}
+
+// recentBrokersPath returns the location of the recent brokers history file
+func recentBrokersPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "mqttui", "recent.json"), nil
+}
+
+// LoadRecentBrokers reads the recent brokers history, most recent first. A
+// missing file is an empty history.
+func LoadRecentBrokers(path string) ([]RecentBroker, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var recent []RecentBroker
+	if err := json.Unmarshal(data, &recent); err != nil {
+		return nil, err
+	}
+	return recent, nil
+}
+
+// RecordRecentBroker moves the config's broker to the front of the history,
+// dropping the oldest entries beyond maxRecentBrokers
+func RecordRecentBroker(path string, config Config) error {
+	recent, err := LoadRecentBrokers(path)
+	if err != nil {
+		// Start over rather than failing on a corrupt history
+		recent = nil
+	}
+
+	entry := RecentBroker{
+		BrokerURL: config.BrokerURL,
+		Username:  config.Username,
+		ClientID:  config.ClientID,
+		LastUsed:  time.Now(),
+	}
+	updated := []RecentBroker{entry}
+	for _, r := range recent {
+		if r.BrokerURL != entry.BrokerURL && len(updated) < maxRecentBrokers {
+			updated = append(updated, r)
+		}
+	}
+
+	data, err := json.MarshalIndent(updated, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// InputMode is what the text input line is currently collecting
+type InputMode int
+
+const (
+	NoInput InputMode = iota
+	BookmarkNoteInput
+	FieldFilterInput
+	PublishInput
+	TopicFilterInput
+	ExportInput
+	SubscribeInput
+	WatchInput
+	SearchInput
+	RepublishInput
+)
+
+// subscribePrompt is the prompt of the subscription filter input
+const subscribePrompt = "Subscribe to (+ and # wildcards): "
+
+// PublishRequestMsg asks the application to publish a payload composed in the UI,
+// or republish a received one with its QoS and retained flag
+type PublishRequestMsg struct {
+	Topic    string
+	Payload  string
+	QoS      byte
+	Retained bool
+}
+
+// SubscribeRequestMsg asks the application to subscribe to a filter the UI
+// already lists as subscribed, at the QoS new subscriptions use
+type SubscribeRequestMsg struct {
+	Topic string
+}
+
+// maxPublishFileBytes caps the size of a file published with @path
+const maxPublishFileBytes = 16 << 20
+
+// publishFileFailedMsg reports a payload file that couldn't be published
+type publishFileFailedMsg struct {
+	Path string
+	Err  error
+}
+
+// publishFileCmd reads a payload file and asks for it to be published with
+// its bytes exactly as they are
+func publishFileCmd(topic, path string) tea.Cmd {
+	return func() tea.Msg {
+		if path == "" {
+			return publishFileFailedMsg{Path: path, Err: fmt.Errorf("no file after @")}
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return publishFileFailedMsg{Path: path, Err: err}
+		}
+		if !info.Mode().IsRegular() {
+			return publishFileFailedMsg{Path: path, Err: fmt.Errorf("not a regular file")}
+		}
+		if info.Size() > maxPublishFileBytes {
+			return publishFileFailedMsg{Path: path, Err: fmt.Errorf("%s is over the %s limit", formatBytes(int(info.Size())), formatBytes(maxPublishFileBytes))}
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return publishFileFailedMsg{Path: path, Err: err}
+		}
+		return PublishRequestMsg{Topic: topic, Payload: string(data)}
+	}
+}
+
+// jsonPayloadError reports why a payload that looks like JSON, starting with
+// { or [, isn't valid JSON; other payloads aren't checked
+func jsonPayloadError(payload string) error {
+	trimmed := strings.TrimSpace(payload)
+	if !strings.HasPrefix(trimmed, "{") && !strings.HasPrefix(trimmed, "[") {
+		return nil
+	}
+	if json.Valid([]byte(trimmed)) {
+		return nil
+	}
+	var v any
+	if err := json.Unmarshal([]byte(trimmed), &v); err != nil {
+		return err
+	}
+	return fmt.Errorf("invalid JSON")
+}
+
+// confirmPublish answers the prompt for a payload that isn't valid JSON: y
+// sends it anyway, e goes back to editing it and anything else drops it
+func (ui *UI) confirmPublish(key string) tea.Cmd {
+	request := *ui.pendingPublish
+	ui.pendingPublish = nil
+	switch key {
+	case "y":
+		return func() tea.Msg {
+			return request
+		}
+	case "e":
+		return ui.startInput(PublishInput, fmt.Sprintf("Publish to %s: ", request.Topic), request.Payload)
+	}
+	return ui.FlashNotice("Not published")
+}
+
+// republishPrompt is the prompt of the republish input, showing whether the
+// message goes out retained
+func (ui *UI) republishPrompt() string {
+	if ui.retainRepublish {
+		return "Republish retained to (ctrl+r not retained): "
+	}
+	return "Republish to (ctrl+r retained): "
+}
+
+// newTextInput creates the single-line text input shared by all input modes
+func newTextInput() textinput.Model {
+	input := textinput.New()
+	input.CharLimit = 4096
+	return input
+}
+
+// startInput switches the footer to a text input for the given mode
+func (ui *UI) startInput(mode InputMode, prompt, value string) tea.Cmd {
+	ui.inputMode = mode
+	ui.input.Prompt = prompt
+	ui.input.SetValue(value)
+	ui.input.CursorEnd()
+	return ui.input.Focus()
+}
+
+// stopInput leaves input mode
+func (ui *UI) stopInput() {
+	ui.inputMode = NoInput
+	ui.input.Blur()
+	ui.input.SetValue("")
+}
+
+// CapturesInput reports whether keys are going to a text input, the help
+// overlay or a y/n prompt, so global shortcuts like q must not act on them
+func (ui *UI) CapturesInput() bool {
+	return ui.inputMode != NoInput || ui.showHelp || ui.awaitingAnswer()
+}
+
+// awaitingAnswer reports whether a prompt takes the next key: the reset
+// confirmation, a bulk subscribe or publishing a payload that isn't valid JSON
+func (ui *UI) awaitingAnswer() bool {
+	return ui.confirmingReset || ui.pendingSubscribe != nil || ui.pendingPublish != nil
+}
+
+// handleInputKey handles keyboard input while a text input is active
+func (ui *UI) handleInputKey(msg tea.KeyMsg) (*UI, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		if ui.inputMode == TopicFilterInput {
+			ui.setTopicFilter("")
+		}
+		if ui.inputMode == SearchInput {
+			ui.setSearch("")
+		}
+		ui.stopInput()
+		return ui, nil
+	case "ctrl+r":
+		// Republishing keeps the original retained flag unless toggled
+		if ui.inputMode == RepublishInput {
+			ui.retainRepublish = !ui.retainRepublish
+			ui.input.Prompt = ui.republishPrompt()
+			return ui, nil
+		}
+	case "enter":
+		value := ui.input.Value()
+		mode := ui.inputMode
+		ui.stopInput()
+		return ui, ui.submitInput(mode, value)
+	}
+
+	var cmd tea.Cmd
+	ui.input, cmd = ui.input.Update(msg)
+	if ui.inputMode == TopicFilterInput {
+		ui.setTopicFilter(ui.input.Value())
+	}
+	if ui.inputMode == SearchInput {
+		ui.setSearch(ui.input.Value())
+	}
+	return ui, cmd
+}
+
+// submitInput applies the value entered for an input mode
+func (ui *UI) submitInput(mode InputMode, value string) tea.Cmd {
+	switch mode {
+	case BookmarkNoteInput:
+		ui.setBookmarkNote(value)
+	case FieldFilterInput:
+		ui.setFieldFilter(value)
+	case TopicFilterInput:
+		ui.setTopicFilter(value)
+	case SearchInput:
+		ui.setSearch(value)
+		ui.jumpToMatch(1)
+	case SubscribeInput:
+		filter := strings.TrimSpace(value)
+		if err := validateTopicFilter(filter); err != nil {
+			// Keep the input open so the filter can be fixed
+			ui.SetError(fmt.Sprintf("Invalid filter: %v", err))
+			return ui.startInput(SubscribeInput, subscribePrompt, value)
+		}
+		if strings.HasPrefix(ui.error, "Invalid filter") {
+			ui.SetError("")
+		}
+		// Asking again, perhaps at another QoS, goes to the client to settle
+		if ui.subscribedTopics[filter] {
+			ui.addExplicitFilter(filter)
+			return func() tea.Msg {
+				return SubscribeRequestMsg{Topic: filter}
+			}
+		}
+		ui.addExplicitSubscription(filter)
+	case WatchInput:
+		if value == "" {
+			ui.watch, ui.watchExpr = nil, ""
+			return ui.FlashNotice("Not watching")
+		}
+		re, err := regexp.Compile(value)
+		if err != nil {
+			ui.SetError(fmt.Sprintf("Invalid watch: %v", err))
+			return ui.startInput(WatchInput, watchPrompt, value)
+		}
+		if strings.HasPrefix(ui.error, "Invalid watch") {
+			ui.SetError("")
+		}
+		ui.watch, ui.watchExpr = re, value
+		return ui.FlashNotice("Watching for " + value)
+	case ExportInput:
+		if strings.TrimSpace(value) == "" {
+			return nil
+		}
+		return ui.exportMessagesCmd(strings.TrimSpace(value))
+	case PublishInput:
+		topic := ui.publishTopic
+		if path, ok := strings.CutPrefix(value, "@"); ok && !strings.HasPrefix(path, "@") {
+			return publishFileCmd(topic, strings.TrimSpace(path))
+		}
+		// @@ escapes a payload that really starts with @
+		if strings.HasPrefix(value, "@@") {
+			value = value[1:]
+		}
+		request := PublishRequestMsg{Topic: topic, Payload: value}
+		// Hand-typed JSON with a typo is held back until confirmed
+		if jsonPayloadError(value) != nil {
+			ui.pendingPublish = &request
+			return nil
+		}
+		return func() tea.Msg {
+			return request
+		}
+	case RepublishInput:
+		topic := strings.TrimSpace(value)
+		if topic == "" {
+			return nil
+		}
+		if err := validateTopicName(topic); err != nil {
+			// Keep the input open so the topic can be fixed
+			ui.SetError(fmt.Sprintf("Invalid topic: %v", err))
+			return ui.startInput(RepublishInput, ui.republishPrompt(), value)
+		}
+		if strings.HasPrefix(ui.error, "Invalid topic") {
+			ui.SetError("")
+		}
+		request := PublishRequestMsg{
+			Topic:    topic,
+			Payload:  string(payloadBytes(ui.republish)),
+			QoS:      ui.republish.QoS,
+			Retained: ui.retainRepublish,
+		}
+		return func() tea.Msg {
+			return request
+		}
+	}
+	return nil
+}
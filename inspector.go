@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/mattn/go-runewidth"
+)
+
+// sizeBucket is one bar of the payload size histogram
+type sizeBucket struct {
+	Label string
+	Max   int // exclusive upper bound in bytes, 0 for unbounded
+	Count int
+}
+
+// payloadSizeHistogram buckets the payload sizes of the given messages
+func payloadSizeHistogram(msgs []Message) []sizeBucket {
+	buckets := []sizeBucket{
+		{Label: "<100B", Max: 100},
+		{Label: "100B-1KB", Max: 1024},
+		{Label: "1-10KB", Max: 10 * 1024},
+		{Label: "10-100KB", Max: 100 * 1024},
+		{Label: ">=100KB"},
+	}
+
+	for _, msg := range msgs {
+		size := len(msg.Payload)
+		for i := range buckets {
+			if buckets[i].Max == 0 || size < buckets[i].Max {
+				buckets[i].Count++
+				break
+			}
+		}
+	}
+	return buckets
+}
+
+// topicMessages returns the buffered messages received on a topic
+func (ui *UI) topicMessages(topic string) []Message {
+	var msgs []Message
+	for _, msg := range ui.messages {
+		if msg.Topic == topic {
+			msgs = append(msgs, msg)
+		}
+	}
+	return msgs
+}
+
+// renderTopicInspector renders details for the inspected topic in place of the messages pane
+func (ui *UI) renderTopicInspector(width, height int) string {
+	topic := ui.inspectedTopic
+	msgs := ui.topicMessages(topic)
+
+	lines := []string{
+		ui.styles.MessageTopic.Render(topic),
+		"",
+	}
+
+	if stats, ok := ui.topicStats[topic]; ok {
+		lines = append(lines,
+			fmt.Sprintf("Messages:  %d", stats.Count),
+			fmt.Sprintf("Last seen: %s", stats.LastSeen.Format("2006-01-02 15:04:05")),
+		)
+	} else {
+		lines = append(lines, "No messages received on this topic yet")
+	}
+
+	lines = append(lines, ui.valueTrend(topic, width-4)...)
+
+	if len(msgs) > 0 {
+		lines = append(lines, "", "Payload sizes:")
+		lines = append(lines, ui.renderHistogram(payloadSizeHistogram(msgs), width-6)...)
+
+		latest := msgs[len(msgs)-1]
+		payload := latest.Payload
+		if pretty, ok := prettyJSON(payload); ok {
+			payload = pretty
+		} else {
+			payload = sanitizePayload(payload)
+		}
+		lines = append(lines, "", fmt.Sprintf("Latest payload (%d bytes):", len(latest.Payload)))
+		lines = append(lines, ui.renderGutter(payload, width-2)...)
+	}
+
+	return ui.renderInspectorPager("Inspector", lines, width, height)
+}
+
+// renderMessageInspector renders every detail of the inspected message and
+// its complete payload in place of the messages pane
+func (ui *UI) renderMessageInspector(width, height int) string {
+	i, ok := ui.messageIndex(ui.inspectedMessage)
+	if !ok {
+		lines := []string{ui.styles.UnselectedItem.Render("The message is no longer buffered")}
+		return ui.renderInspectorPager("Message", lines, width, height)
+	}
+	msg := ui.messages[i]
+
+	lines := []string{
+		ui.styles.MessageTopic.Render(msg.Topic),
+		"",
+		fmt.Sprintf("Received: %s", msg.Timestamp.In(ui.timeZone).Format("2006-01-02 15:04:05.000 MST")),
+		fmt.Sprintf("QoS:      %d", msg.QoS),
+		fmt.Sprintf("Retained: %t", msg.Retained),
+		fmt.Sprintf("Size:     %d bytes", len(payloadBytes(msg))),
+	}
+	if msg.Queued {
+		lines = append(lines, "Queued during a disconnect")
+	}
+	if note, ok := ui.bookmarks[msg.Seq]; ok {
+		lines = append(lines, fmt.Sprintf("Bookmark: %s", note))
+	}
+	if msg.DecodeErr != "" {
+		lines = append(lines, ui.styles.Error.Render("Transform: "+msg.DecodeErr))
+	}
+	lines = append(lines, messagePropertyLines(msg.Properties)...)
+	lines = append(lines, ui.valueTrend(msg.Topic, width-4)...)
+
+	// The diff replaces the payload with its changes from the message before
+	if ui.diffMode {
+		lines = append(lines, ui.payloadDiff(i, width)...)
+		return ui.renderInspectorPager("Message diff", lines, width, height)
+	}
+
+	var payload []string
+	data, binary, note := ui.decodedPayload(msg)
+	if binary {
+		payload = hexDump(data, 0)
+	} else {
+		text := string(data)
+		if pretty, ok := prettyJSON(text); ok {
+			text = pretty
+		} else {
+			text = sanitizePayload(text)
+		}
+		payload = ui.renderGutter(text, width-2)
+	}
+	heading := "Payload:"
+	if ui.decoder != TextDecoder {
+		heading = fmt.Sprintf("Payload (%s):", ui.decoder)
+	}
+	if note != "" {
+		heading += " " + note
+	}
+	lines = append(lines, "", heading)
+	lines = append(lines, payload...)
+
+	return ui.renderInspectorPager("Message", lines, width, height)
+}
+
+// messagePropertyLines lists the MQTT 5 properties of a message, nothing
+// for messages without any
+func messagePropertyLines(props *MessageProperties) []string {
+	if props == nil {
+		return nil
+	}
+	lines := []string{"", "Properties:"}
+	if props.ContentType != "" {
+		lines = append(lines, "  Content type:     "+sanitizePayload(props.ContentType))
+	}
+	if props.ResponseTopic != "" {
+		lines = append(lines, "  Response topic:   "+sanitizePayload(props.ResponseTopic))
+	}
+	if len(props.CorrelationData) > 0 {
+		// Correlation data is often a UUID string, but may be any bytes
+		data := hex.EncodeToString(props.CorrelationData)
+		if isText(props.CorrelationData) {
+			data = strconv.Quote(string(props.CorrelationData))
+		}
+		lines = append(lines, "  Correlation data: "+data)
+	}
+	for _, user := range props.User {
+		lines = append(lines, fmt.Sprintf("  %s: %s", sanitizePayload(user.Key), sanitizePayload(user.Value)))
+	}
+	return lines
+}
+
+// renderInspectorPager renders inspector lines in place of the messages
+// pane, scrolled like a pager
+func (ui *UI) renderInspectorPager(title string, lines []string, width, height int) string {
+	availableLines := height - 3
+	if availableLines < 1 {
+		availableLines = 1
+	}
+	maxScroll := len(lines) - availableLines
+	if maxScroll < 0 {
+		maxScroll = 0
+	}
+	if ui.inspectorScroll > maxScroll {
+		ui.inspectorScroll = maxScroll
+	}
+	if ui.inspectorScroll > 0 {
+		title += " ↑"
+	}
+	if ui.inspectorScroll < maxScroll {
+		title += " ↓"
+	}
+	lines = lines[ui.inspectorScroll:]
+	if len(lines) > availableLines {
+		lines = lines[:availableLines]
+	}
+
+	style := ui.styles.InactivePane
+	if ui.activePane == MessagesPane {
+		style = ui.styles.ActivePane
+		title = ui.activeTitle(title)
+	}
+
+	return style.
+		Width(width).
+		Height(height).
+		Render(lipgloss.JoinVertical(
+			lipgloss.Left,
+			ui.styles.Title.Render(title),
+			strings.Join(lines, "\n"),
+		))
+}
+
+// renderHistogram renders buckets as a horizontal bar chart fitting within width
+func (ui *UI) renderHistogram(buckets []sizeBucket, width int) []string {
+	labelWidth := 0
+	maxCount := 0
+	for _, b := range buckets {
+		if len(b.Label) > labelWidth {
+			labelWidth = len(b.Label)
+		}
+		if b.Count > maxCount {
+			maxCount = b.Count
+		}
+	}
+
+	// Leave room for the label, separators and the count
+	barWidth := width - labelWidth - len(fmt.Sprint(maxCount)) - 3
+	if barWidth < 1 {
+		barWidth = 1
+	}
+
+	lines := make([]string, 0, len(buckets))
+	for _, b := range buckets {
+		bar := 0
+		if maxCount > 0 {
+			bar = b.Count * barWidth / maxCount
+		}
+		if b.Count > 0 && bar == 0 {
+			bar = 1
+		}
+		lines = append(lines, fmt.Sprintf("%-*s %s %d",
+			labelWidth, b.Label,
+			ui.styles.MessageTopic.Render(strings.Repeat("█", bar)),
+			b.Count))
+	}
+	return lines
+}
+
+// prettyJSON indents a JSON payload, reporting false if it isn't valid JSON
+func prettyJSON(payload string) (string, bool) {
+	if !json.Valid([]byte(payload)) {
+		return payload, false
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, []byte(payload), "", "  "); err != nil {
+		return payload, false
+	}
+	return buf.String(), true
+}
+
+// renderGutter renders text with a line-number gutter sized to the line
+// count. Lines wider than width are wrapped with a blank gutter so the
+// numbers keep matching the payload's own lines.
+func (ui *UI) renderGutter(text string, width int) []string {
+	textLines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	gutterWidth := len(strconv.Itoa(len(textLines)))
+	textWidth := width - gutterWidth - 3
+	if textWidth < 10 {
+		textWidth = 10
+	}
+
+	blank := ui.styles.MessageTime.Render(strings.Repeat(" ", gutterWidth) + " │ ")
+	var lines []string
+	for i, line := range textLines {
+		gutter := ui.styles.MessageTime.Render(fmt.Sprintf("%*d │ ", gutterWidth, i+1))
+		for first := true; first || line != ""; first = false {
+			chunk := runewidth.Truncate(line, textWidth, "")
+			if chunk == "" && line != "" {
+				// Always make progress, even on a rune wider than the text column
+				_, size := utf8.DecodeRuneInString(line)
+				chunk = line[:size]
+			}
+			line = line[len(chunk):]
+			if first {
+				lines = append(lines, gutter+chunk)
+			} else {
+				lines = append(lines, blank+chunk)
+			}
+		}
+	}
+	return lines
+}
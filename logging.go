@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// LogLevel selects how much is logged; each level includes the ones before it
+type LogLevel int
+
+const (
+	LogError LogLevel = iota
+	LogInfo
+	LogDebug
+)
+
+// String returns the level's name as used in MQTT_LOG_LEVEL
+func (l LogLevel) String() string {
+	switch l {
+	case LogError:
+		return "error"
+	case LogDebug:
+		return "debug"
+	default:
+		return "info"
+	}
+}
+
+// parseLogLevel parses a level name: error, info or debug
+func parseLogLevel(name string) (LogLevel, error) {
+	switch strings.ToLower(name) {
+	case "error":
+		return LogError, nil
+	case "info":
+		return LogInfo, nil
+	case "debug":
+		return LogDebug, nil
+	}
+	return LogInfo, fmt.Errorf("must be error, info or debug")
+}
+
+// logger receives every log line. Until setupLogging runs it writes to
+// stderr, which is still safe before the interface takes over the screen.
+var (
+	logger   = log.New(os.Stderr, "", log.LstdFlags)
+	logLevel = LogInfo
+)
+
+// setupLogging sends logging to file, or discards it when file is empty, so
+// nothing is written over the interface. The returned function closes the
+// file.
+func setupLogging(file string, level LogLevel) (func(), error) {
+	out := io.Discard
+	closeLog := func() {}
+	if file != "" {
+		f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return closeLog, err
+		}
+		out = f
+		closeLog = func() { f.Close() }
+	}
+	logger.SetOutput(out)
+	logLevel = level
+
+	// Libraries logging through the standard logger end up in the same place
+	log.SetOutput(out)
+
+	// paho logs nothing unless given loggers
+	mqtt.ERROR = pahoLogger{LogError}
+	mqtt.CRITICAL = pahoLogger{LogError}
+	mqtt.WARN = pahoLogger{LogInfo}
+	mqtt.DEBUG = pahoLogger{LogDebug}
+	return closeLog, nil
+}
+
+// logf logs a line if the configured level includes level
+func logf(level LogLevel, format string, args ...any) {
+	if level > logLevel {
+		return
+	}
+	logger.Printf(strings.ToUpper(level.String())+" "+format, args...)
+}
+
+// logError logs failures and invalid settings
+func logError(format string, args ...any) {
+	logf(LogError, format, args...)
+}
+
+// logInfo logs connection state changes and other notable events
+func logInfo(format string, args ...any) {
+	logf(LogInfo, format, args...)
+}
+
+// logDebug logs detail for tracing connection and subscription churn
+func logDebug(format string, args ...any) {
+	logf(LogDebug, format, args...)
+}
+
+// pahoLogger adapts paho's loggers to a log level
+type pahoLogger struct {
+	level LogLevel
+}
+
+func (p pahoLogger) Println(v ...any) {
+	logf(p.level, "paho: %s", strings.TrimSuffix(fmt.Sprintln(v...), "\n"))
+}
+
+func (p pahoLogger) Printf(format string, v ...any) {
+	logf(p.level, "paho: "+format, v...)
+}
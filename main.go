@@ -1,69 +1,446 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
-	"log"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 )
 
 func main() {
+	captureFile := flag.String("capture", "", "record received messages to a binary capture file")
+	replayFile := flag.String("replay", "", "replay a binary capture file instead of connecting to a broker")
+	check := flag.Bool("check", false, "test the broker connection, print diagnostics and exit")
+	profile := flag.String("profile", "", "connect with the named profile from the profiles file")
+	topicsFile := flag.String("topics-file", "", "subscribe to the topic filters listed in this file, following changes to it")
+	noRestore := flag.Bool("no-restore", false, "start without the subscriptions saved by the previous run, and don't save them")
+	headless := flag.Bool("headless", false, "print received messages to stdout as JSON lines instead of starting the interface")
+	topics := flag.String("topics", "", "comma-separated topic filters to subscribe to instead of discovering topics with # (--headless defaults to #)")
+
+	// Connection flags override their environment variables
+	connectionFlags := map[string]string{
+		"broker":    "MQTT_BROKER",
+		"username":  "MQTT_USERNAME",
+		"password":  "MQTT_PASSWORD",
+		"client-id": "MQTT_CLIENT_ID",
+		"qos":       "MQTT_QOS",
+	}
+	flag.String("broker", "", "broker URL, or several comma-separated (overrides MQTT_BROKER)")
+	flag.String("username", "", "username (overrides MQTT_USERNAME)")
+	flag.String("password", "", "password (overrides MQTT_PASSWORD); visible to other local users, prefer the environment")
+	flag.String("client-id", "", "client ID, {hostname} and {rand} are filled in (overrides MQTT_CLIENT_ID)")
+	flag.String("qos", "", "QoS for discovery and subscriptions, 0, 1 or 2 (overrides MQTT_QOS)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags]\n\n", os.Args[0])
+		fmt.Fprintln(flag.CommandLine.Output(), "Settings come from flags, then MQTT_* environment variables, then defaults.")
+		fmt.Fprintln(flag.CommandLine.Output())
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	flag.Visit(func(f *flag.Flag) {
+		if key, ok := connectionFlags[f.Name]; ok {
+			flagSettings[key] = f.Value.String()
+		}
+	})
+
+	config, err := resolveProfile(loadConfig(), *profile, !*check)
+	if errors.Is(err, errProfileCancelled) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Profile: %v\n", err)
+		os.Exit(1)
+	}
+	config.CaptureFile = *captureFile
+	config.ReplayFile = *replayFile
+	config.RestoreSubscriptions = !*noRestore
+	config.TopicsFile = *topicsFile
+	config.Topics, err = parseTopicList(*topics)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Topics: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *check {
+		os.Exit(runCheck(config, os.Stdout))
+	}
+	if *headless {
+		os.Exit(runHeadless(config, os.Stdout))
+	}
+
+	// From here on log lines would be drawn over the interface
+	closeLog, err := setupLogging(config.LogFile, config.LogLevel)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Log file: %v\n", err)
+		os.Exit(1)
+	}
+
 	// Initialize the MQTT TUI application
-	app := NewApp()
+	app := NewApp(config)
 
 	// Create the Bubble Tea program with options for proper terminal handling
-	p := tea.NewProgram(
-		app,
-		tea.WithAltScreen(),
-	)
+	opts := []tea.ProgramOption{tea.WithAltScreen()}
+	if app.config.PauseOnBlur {
+		opts = append(opts, tea.WithReportFocus())
+	}
+	if app.config.Mouse {
+		opts = append(opts, tea.WithMouseCellMotion())
+	}
+	p := tea.NewProgram(app, opts...)
 
 	// Set the program reference in MQTT client for sending messages
+	app.program = p
 	if app.mqtt != nil {
 		app.mqtt.SetProgram(p)
 	}
 
 	// Run the program
-	if _, err := p.Run(); err != nil {
-		log.Fatal(err)
+	_, err = p.Run()
+	closeLog()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
 	}
 } // App represents the main application state
 type App struct {
-	mqtt     *MQTTClient
-	ui       *UI
-	config   Config
-	quitting bool
+	mqtt        *MQTTClient
+	ui          *UI
+	config      Config
+	replayer    *Replayer
+	transformer *Transformer
+	quitting    bool
+
+	// program is handed to MQTT clients created after startup
+	program *tea.Program
+
+	// clientIDTemplate is the configured client ID before expansion, which
+	// is what the recent brokers history keeps
+	clientIDTemplate string
+
+	// subsRestored is set once the saved subscriptions have been made
+	// again; savedSubs is what was last saved
+	subsRestored bool
+	savedSubs    SavedSubscriptions
+
+	// savingOnQuit is set while the messages are exported before quitting
+	savingOnQuit bool
+
+	// fileTopics are the filters last applied from the topics file, and
+	// topicsFileErr the last problem reading it; topicsPolling is set once
+	// the file is being watched
+	fileTopics    []string
+	topicsFileErr string
+	topicsPolling bool
+
+	// watchdogRunning is set once the stall watchdog has started
+	watchdogRunning bool
 }
 
 // Config holds the MQTT broker configuration
 type Config struct {
+	// Profile names the profile the connection settings came from, if any
+	Profile string
+
 	BrokerURL string
 	Username  string
 	Password  string
 	ClientID  string
+	Minimal   bool
+
+	// CACertPath, ClientCertPath and ClientKeyPath are PEM files used for
+	// TLS brokers (ssl://, mqtts://, ...); TLSInsecure skips verifying the
+	// broker certificate
+	CACertPath     string
+	ClientCertPath string
+	ClientKeyPath  string
+	TLSInsecure    bool
+
+	// ShowDiscoveryMessages streams every message seen by the # discovery
+	// subscription into the message pane, not just subscribed topics
+	ShowDiscoveryMessages bool
+
+	// AutoSubscribe subscribes to topics as discovery finds them, until
+	// AutoSubscribeMax subscriptions have been made (0 for no cap)
+	AutoSubscribe    bool
+	AutoSubscribeMax int
+
+	// TopicPreview shows each topic's latest payload in the topics pane
+	TopicPreview bool
+
+	// PauseOnBlur freezes the display while the terminal is unfocused
+	PauseOnBlur bool
+
+	// Sparklines draws each topic's message rate over the last seconds in
+	// the topics pane
+	Sparklines bool
+
+	// ActivityWindow is how long a topic stays highlighted after a message,
+	// 0 to not highlight
+	ActivityWindow time.Duration
+
+	// Watch is a regular expression; messages whose topic or payload match
+	// are flagged and ring the terminal bell
+	Watch string
+
+	// Theme names the color preset: dark, light or mono
+	Theme string
+
+	// Mouse enables clicking topics and messages and wheel scrolling, at the
+	// cost of the terminal's own text selection
+	Mouse bool
+
+	// ResetConfirm asks before the r key clears messages, and ResetScope
+	// selects what it clears: "all" messages or only the selected "topic"
+	ResetConfirm bool
+	ResetScope   string
+
+	// BridgeFilter selects messages to republish to BridgeBroker, or to the
+	// same broker when BridgeBroker is empty, under BridgePrefix
+	BridgeFilter string
+	BridgeBroker string
+	BridgePrefix string
+
+	// CaptureFile records received messages in the binary capture format;
+	// ReplayFile plays such a capture back instead of connecting
+	CaptureFile string
+	ReplayFile  string
+
+	// SessionFile keeps the discovered topics and messages between runs
+	SessionFile string
+
+	// TopicsFile lists topic filters to subscribe to, one per line; edits
+	// to it subscribe and unsubscribe while running
+	TopicsFile string
+
+	// Topics are the filters given with --topics, subscribed to on connect
+	// instead of discovering topics with #; the topics list is filled from
+	// the messages they receive
+	Topics []string
+
+	// RestoreSubscriptions saves the subscriptions as they change and makes
+	// them again after connecting on the next run
+	RestoreSubscriptions bool
+
+	// RediscoverOnReconnect re-runs topic discovery after a reconnect, not
+	// just after the initial connection
+	RediscoverOnReconnect bool
+
+	// VerifyResubscribe checks the broker's SUBACK for every subscription
+	// restored after a reconnect and reports the ones that failed
+	VerifyResubscribe bool
+
+	// QoS is requested for discovery and, until changed with Q, for subscriptions
+	QoS byte
+
+	// QoSDowngrade is what happens when the broker grants a subscription a
+	// lower QoS than requested: "accept", "warn" or "error" (unsubscribe)
+	QoSDowngrade string
+
+	// DisconnectQuiesce is how long paho gets to finish outstanding work when
+	// disconnecting; InFlightTimeout bounds the wait for QoS 1/2 publishes
+	// to complete before that, 0 to not wait
+	DisconnectQuiesce time.Duration
+	InFlightTimeout   time.Duration
+
+	// ConnectTimeout bounds each broker's connection attempt, so an
+	// unreachable broker fails instead of hanging; KeepAlive is the MQTT
+	// keepalive interval
+	ConnectTimeout time.Duration
+	KeepAlive      time.Duration
+
+	// StallTimeout is how long a connection may go without traffic before
+	// the watchdog probes the broker, 0 to not watch
+	StallTimeout time.Duration
+
+	// FlushInterval batches received messages into one UI update per
+	// interval, 0 to update for every message
+	FlushInterval time.Duration
+
+	// CleanSession starts every connection afresh; off, the broker keeps the
+	// subscriptions and queues QoS 1/2 messages for the client ID while it
+	// is away
+	CleanSession bool
+
+	// ProtocolVersion is the MQTT protocol level sent in CONNECT: 3 for
+	// 3.1, 4 for 3.1.1, 5 for MQTT 5, 0 to try 3.1.1 and fall back to 3.1
+	ProtocolVersion uint
+
+	// MaxReconnectInterval caps the backoff between reconnection attempts
+	MaxReconnectInterval time.Duration
+
+	// TopicColors colors topics by regex capture group values
+	TopicColors []TopicColorRule
+
+	// MessageBadges shows each message's QoS and retained flag next to its
+	// topic
+	MessageBadges bool
+
+	// JSONPath is a dotted field selector, e.g. .temperature, whose value is
+	// shown prominently with each JSON message
+	JSONPath string
+
+	// MaxPayloadLines caps the payload lines shown per message, 0 for no cap
+	MaxPayloadLines int
+
+	// MaxPayloadDisplay caps the payload bytes rendered in the messages
+	// pane, 0 for no cap; messages keep the full payload
+	MaxPayloadDisplay int
+
+	// MaxMessages caps the message buffer, dropping the oldest, 0 for no cap
+	MaxMessages int
+
+	// MessageTTL drops messages once they are older than this, 0 to keep
+	// them until MaxMessages pushes them out
+	MessageTTL time.Duration
+
+	// ExportFile is the file suggested when exporting messages
+	ExportFile string
+
+	// TimestampPrecision sets how message times are shown: "seconds",
+	// "millis" or "micros"
+	TimestampPrecision string
+
+	// TimeFormat is a Go time layout for message times, or "relative" for
+	// ages like "3s ago"; it overrides TimestampPrecision. TimeZone is the
+	// IANA zone times are shown in, local time when empty.
+	TimeFormat string
+	TimeZone   string
+
+	// LogFile receives log lines at LogLevel and above; without one they are
+	// discarded, as anything written to the terminal garbles the interface
+	LogFile  string
+	LogLevel LogLevel
+
+	// Pipeline decodes payloads through built-in steps before they are
+	// shown, nil for none
+	Pipeline *DecodePipeline
+
+	// Transforms pipe payloads of matching topics through external commands
+	// and display their output instead of the raw payload
+	Transforms []PayloadTransform
 }
 
-// NewApp creates a new application instance
-func NewApp() *App {
-	config := Config{
-		BrokerURL: getEnvOrDefault("MQTT_BROKER", "tcp://localhost:1883"),
-		Username:  getEnvOrDefault("MQTT_USERNAME", ""),
-		Password:  getEnvOrDefault("MQTT_PASSWORD", ""),
-		ClientID:  getEnvOrDefault("MQTT_CLIENT_ID", "mqttui"),
+// discovers reports whether topics are discovered with a # subscription,
+// which --topics turns off
+func (c Config) discovers() bool {
+	return len(c.Topics) == 0
+}
+
+// defaultClientID is the client ID template used when none is configured;
+// its random suffix keeps instances from colliding but can't identify a
+// persistent session
+const defaultClientID = "mqttui-{rand}"
+
+// loadConfig builds the configuration from environment variables
+func loadConfig() Config {
+	return Config{
+		BrokerURL:             getEnvOrDefault("MQTT_BROKER", "tcp://localhost:1883"),
+		Username:              getEnvOrDefault("MQTT_USERNAME", ""),
+		Password:              getEnvOrDefault("MQTT_PASSWORD", ""),
+		ClientID:              getEnvOrDefault("MQTT_CLIENT_ID", defaultClientID),
+		Minimal:               getEnvBool("MQTT_MINIMAL", false),
+		CACertPath:            getEnvOrDefault("MQTT_CA_CERT", ""),
+		ClientCertPath:        getEnvOrDefault("MQTT_CLIENT_CERT", ""),
+		ClientKeyPath:         getEnvOrDefault("MQTT_CLIENT_KEY", ""),
+		TLSInsecure:           getEnvBool("MQTT_TLS_INSECURE", false),
+		TopicPreview:          getEnvBool("MQTT_TOPIC_PREVIEW", false),
+		AutoSubscribe:         getEnvBool("MQTT_AUTO_SUBSCRIBE", false),
+		AutoSubscribeMax:      getEnvInt("MQTT_AUTO_SUBSCRIBE_MAX", 200),
+		ShowDiscoveryMessages: getEnvBool("MQTT_SHOW_DISCOVERY_MESSAGES", false),
+		PauseOnBlur:           getEnvBool("MQTT_PAUSE_ON_BLUR", false),
+		Mouse:                 getEnvBool("MQTT_MOUSE", true),
+		Theme:                 getEnvOrDefault("MQTT_THEME", "dark"),
+		Watch:                 getEnvOrDefault("MQTT_WATCH", ""),
+		ActivityWindow:        getEnvDuration("MQTT_ACTIVITY_WINDOW", 5*time.Second),
+		Sparklines:            getEnvBool("MQTT_SPARKLINES", true),
+		VerifyResubscribe:     getEnvBool("MQTT_VERIFY_RESUBSCRIBE", true),
+		ResetConfirm:          getEnvBool("MQTT_RESET_CONFIRM", true),
+		ResetScope:            getEnvOrDefault("MQTT_RESET_SCOPE", "all"),
+		BridgeFilter:          getEnvOrDefault("MQTT_BRIDGE_FILTER", ""),
+		BridgeBroker:          getEnvOrDefault("MQTT_BRIDGE_BROKER", ""),
+		BridgePrefix:          getEnvOrDefault("MQTT_BRIDGE_PREFIX", ""),
+		RediscoverOnReconnect: getEnvBool("MQTT_REDISCOVER_ON_RECONNECT", true),
+		SessionFile:           getEnvOrDefault("MQTT_SESSION_FILE", ""),
+		QoS:                   getEnvQoS("MQTT_QOS"),
+		QoSDowngrade:          getEnvOrDefault("MQTT_QOS_DOWNGRADE", "warn"),
+		DisconnectQuiesce:     getEnvDuration("MQTT_DISCONNECT_QUIESCE", 250*time.Millisecond),
+		InFlightTimeout:       getEnvDuration("MQTT_IN_FLIGHT_TIMEOUT", 5*time.Second),
+		ConnectTimeout:        getEnvDuration("MQTT_CONNECT_TIMEOUT", 10*time.Second),
+		KeepAlive:             getEnvDuration("MQTT_KEEPALIVE", 30*time.Second),
+		CleanSession:          getEnvBool("MQTT_CLEAN_SESSION", true),
+		FlushInterval:         getEnvDuration("MQTT_FLUSH_INTERVAL", 100*time.Millisecond),
+		StallTimeout:          getEnvDuration("MQTT_STALL_TIMEOUT", 2*time.Minute),
+		ProtocolVersion:       getEnvProtocolVersion("MQTT_PROTOCOL_VERSION"),
+		MaxReconnectInterval:  getEnvDuration("MQTT_MAX_RECONNECT_INTERVAL", 30*time.Second),
+		JSONPath:              getEnvOrDefault("MQTT_JSON_PATH", ""),
+		MessageBadges:         getEnvBool("MQTT_MESSAGE_BADGES", true),
+		MaxPayloadLines:       getEnvInt("MQTT_MAX_PAYLOAD_LINES", 20),
+		MaxPayloadDisplay:     getEnvInt("MQTT_MAX_PAYLOAD_DISPLAY", 64*1024),
+		MaxMessages:           getEnvInt("MQTT_MAX_MESSAGES", 1000),
+		MessageTTL:            getEnvDuration("MQTT_MESSAGE_TTL", 0),
+		ExportFile:            getEnvOrDefault("MQTT_EXPORT_FILE", "mqttui-export.jsonl"),
+		TimestampPrecision:    getEnvOrDefault("MQTT_TIMESTAMP_PRECISION", "millis"),
+		TimeFormat:            getEnvOrDefault("MQTT_TIME_FORMAT", ""),
+		TimeZone:              getEnvOrDefault("MQTT_TZ", ""),
+		Transforms:            getEnvTransforms("MQTT_TRANSFORM"),
+		Pipeline:              getEnvPipeline("MQTT_PIPELINE"),
+		LogFile:               getEnvOrDefault("MQTT_LOG_FILE", ""),
+		LogLevel:              getEnvLogLevel("MQTT_LOG_LEVEL"),
+		TopicColors:           getEnvTopicColors("MQTT_TOPIC_COLORS"),
 	}
+}
 
+// NewApp creates a new application instance
+func NewApp(config Config) *App {
+	// The client ID stays the same for the whole run, reconnects included
+	template := config.ClientID
+	config.ClientID = expandClientID(template)
 	app := &App{
-		config: config,
-		ui:     NewUI(),
+		config:           config,
+		ui:               NewUI(config),
+		clientIDTemplate: template,
+	}
+	if len(config.Transforms) > 0 {
+		app.transformer = NewTransformer(config.Transforms)
+	}
+
+	// Replaying a capture works offline
+	if config.ReplayFile != "" {
+		replayer, err := OpenReplay(config.ReplayFile)
+		if err != nil {
+			logError("Failed to open replay: %v", err)
+			app.ui.SetError(fmt.Sprintf("Replay: %v", err))
+		} else {
+			app.replayer = replayer
+		}
+		return app
 	}
 
 	// Initialize MQTT client
 	mqtt, err := NewMQTTClient(config)
 	if err != nil {
-		log.Printf("Failed to create MQTT client: %v", err)
-		// Continue without MQTT for now - allow offline mode
+		logError("Failed to create MQTT client: %v", err)
+		app.ui.SetError(fmt.Sprintf("MQTT client: %v", err))
+		// Continue offline; c retries creating the client
+		app.ui.SetConnectionStatus(StatusOffline, 0)
 	} else {
 		app.mqtt = mqtt
+		app.ui.SetConnectionStatus(StatusConnecting, 0)
+	}
+	if !config.CleanSession && changesEachRun(template) {
+		logInfo("MQTT_CLEAN_SESSION is off but the client ID %q changes on every run", template)
+		app.ui.SetNotice("Warning: persistent session with a random client ID; set MQTT_CLIENT_ID to a unique, stable ID")
+	}
+
+	// Pick up the topics and messages of the previous run
+	if config.SessionFile != "" {
+		app.restoreSession()
 	}
 
 	return app
@@ -71,6 +448,12 @@ func NewApp() *App {
 
 // Init implements tea.Model
 func (a *App) Init() tea.Cmd {
+	if a.replayer != nil {
+		return tea.Batch(
+			a.ui.Init(),
+			a.replayer.NextCmd(),
+		)
+	}
 	if a.mqtt != nil {
 		return tea.Batch(
 			a.ui.Init(),
@@ -94,27 +477,197 @@ func (a *App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 		return a, tea.Batch(cmds...)
 	case tea.KeyMsg:
+		// While shutting down only a second ctrl+c, which skips the wait, is handled
+		if a.quitting {
+			if msg.String() == "ctrl+c" {
+				return a, tea.Quit
+			}
+			return a, nil
+		}
+		if a.ui.confirmingQuit {
+			return a, a.confirmQuit(msg.String())
+		}
 		switch msg.String() {
-		case "ctrl+c", "q":
-			a.quitting = true
-			if a.mqtt != nil {
-				a.mqtt.Disconnect()
+		case "ctrl+c":
+			return a, a.quit()
+		case "q":
+			// q is just a letter while typing into an input
+			if a.ui.CapturesInput() {
+				break
+			}
+			// Messages nothing else keeps would be lost, so offer to save them
+			if len(a.ui.messages) > 0 && a.config.SessionFile == "" && a.config.CaptureFile == "" {
+				a.ui.confirmingQuit = true
+				return a, nil
+			}
+			return a, a.quit()
+		case "c":
+			// Retry connecting when offline or the first connection failed
+			if !a.ui.CapturesInput() {
+				cmds = append(cmds, a.retryConnect())
 			}
-			return a, tea.Quit
 		}
 	case MQTTConnectedMsg:
-		// Start topic discovery when connected
+		a.ui.SetConnectionStatus(StatusConnected, 0)
+		a.ui.SetBroker(msg.Broker)
+		// Keep the uptime in the status bar current
+		cmds = append(cmds, a.ui.RestartTick())
+		if msg.Reconnect {
+			// The disconnect error is over; subscription problems are
+			// reported separately once they are restored
+			a.ui.SetError("")
+		}
+		// Saved subscriptions are restored before discovery starts, the order
+		// reconnects restore them in, so discovery's # never gets ahead of an
+		// explicit subscription
+		var restore []tea.Cmd
+		if a.mqtt != nil && a.config.RestoreSubscriptions {
+			restore = a.restoreSubscriptions()
+		}
+		// Start topic discovery when connected; reconnects only re-discover if configured
+		if a.mqtt != nil && a.config.discovers() && (!msg.Reconnect || a.config.RediscoverOnReconnect) {
+			cmds = append(cmds, tea.Sequence(tea.Batch(restore...), a.mqtt.DiscoverTopicsCmd()))
+		} else {
+			cmds = append(cmds, restore...)
+		}
+		// Without discovery the --topics filters are subscribed to directly;
+		// reconnects restore them with the other subscriptions
+		if a.mqtt != nil && !a.config.discovers() && !msg.Reconnect {
+			oldSubscribed := a.ui.GetSubscribedTopics()
+			for _, topic := range a.config.Topics {
+				a.ui.addExplicitSubscription(topic)
+			}
+			cmds = append(cmds, a.handleSubscriptionChanges(oldSubscribed, a.ui.GetSubscribedTopics())...)
+		}
+		if !msg.Reconnect {
+			a.recordRecentBroker()
+		}
+		if a.mqtt != nil && a.config.StallTimeout > 0 && !a.watchdogRunning {
+			a.watchdogRunning = true
+			cmds = append(cmds, a.mqtt.WatchdogCmd())
+		}
+		if a.config.TopicsFile != "" && !a.topicsPolling {
+			a.topicsPolling = true
+			cmds = append(cmds, readTopicsFileCmd(a.config.TopicsFile, 0))
+		}
+	case watchdogMsg:
+		// A stalled link is flagged until the broker is heard from again
 		if a.mqtt != nil {
-			cmds = append(cmds, a.mqtt.DiscoverTopicsCmd())
+			status := a.ui.ConnectionStatus()
+			if msg.Stalled && status == StatusConnected {
+				a.ui.SetConnectionStatus(StatusStalled, 0)
+				a.ui.SetError(fmt.Sprintf("Connection looks stalled: the broker hasn't answered after %s without traffic", msg.Quiet.Truncate(time.Second)))
+			} else if !msg.Stalled && status == StatusStalled && a.mqtt.IsConnected() {
+				a.ui.SetConnectionStatus(StatusConnected, 0)
+			}
+			cmds = append(cmds, a.mqtt.WatchdogCmd())
+		}
+	case topicsFileMsg:
+		cmds = append(cmds, a.syncTopicsFile(msg)...)
+	case exportDoneMsg:
+		// Saving before quitting succeeded; a failure is shown and the
+		// interface stays up
+		if a.savingOnQuit {
+			a.savingOnQuit = false
+			if msg.Err == nil {
+				return a, a.quit()
+			}
+		}
+	case statsTickMsg:
+		// Sample the received totals for the throughput in the status bar
+		if a.mqtt != nil {
+			a.ui.SampleThroughput(a.mqtt.Received())
 		}
 	case MQTTTopicsDiscoveredMsg:
 		// Update UI with discovered topics
+		var added []string
+		for _, topic := range msg.Topics {
+			if _, known := slices.BinarySearch(a.ui.topics, topic); !known {
+				added = append(added, topic)
+			}
+		}
 		a.ui.SetTopics(msg.Topics)
+		cmds = append(cmds, a.autoSubscribe(added)...)
+	case MQTTTopicDiscoveredMsg:
+		// Merge topics seen after discovery started
+		a.ui.AddTopic(msg.Topic)
+		cmds = append(cmds, a.autoSubscribe([]string{msg.Topic})...)
+	case TopicsRemovedMsg:
+		// Forget removed topics; clearing them all subscribes to # afresh
+		// so retained messages rediscover the topics still around
+		if a.mqtt != nil {
+			a.mqtt.ForgetTopics(msg.Topics)
+			if msg.All && a.mqtt.IsConnected() && a.config.discovers() {
+				cmds = append(cmds, a.mqtt.DiscoverTopicsCmd())
+			}
+		}
 	case MQTTMessageMsg:
 		// Update UI with new message
-		a.ui.AddMessage(msg.Topic, msg.Payload, msg.Timestamp)
+		cmds = append(cmds, a.addMessage(msg.Message()))
+	case MQTTMessagesMsg:
+		// A flush interval's worth of messages, added before one redraw
+		cmds = append(cmds, a.addMessages(msg.Messages))
+	case ReplayRecordMsg:
+		// Show the replayed message and schedule the next one
+		a.ui.AddTopic(msg.Record.Topic)
+		cmds = append(cmds, a.addMessage(Message{
+			Topic:     msg.Record.Topic,
+			Payload:   string(msg.Record.Payload),
+			Raw:       msg.Record.Payload,
+			QoS:       msg.Record.QoS,
+			Timestamp: msg.Record.Timestamp,
+			Retained:  msg.Record.Retained,
+		}))
+		cmds = append(cmds, a.replayer.NextCmd())
+	case TransformResultMsg:
+		a.ui.SetDecoded(msg.Seq, msg.Output, msg.Err)
+	case ReplayDoneMsg:
+		a.ui.SetNotice(fmt.Sprintf("Replay finished: %d messages", msg.Count))
+	case MQTTDisconnectedMsg:
+		// Tell the user why the broker dropped us
+		a.ui.SetError(fmt.Sprintf("Disconnected: %s", msg.Reason))
+		a.ui.SetConnectionStatus(StatusReconnecting, 0)
+	case MQTTReconnectingMsg:
+		a.ui.SetConnectionStatus(StatusReconnecting, msg.Attempt)
+	case MQTTResubscribedMsg:
+		// Report how many subscriptions survived the reconnect
+		summary := fmt.Sprintf("Restored %d/%d subscriptions", msg.Restored, msg.Total)
+		if len(msg.Failed) > 0 {
+			a.ui.SetError(fmt.Sprintf("%s, failed: %s", summary, strings.Join(msg.Failed, ", ")))
+		} else {
+			a.ui.SetError("")
+			a.ui.SetNotice(summary)
+		}
+	case MQTTSubscriptionDowngradedMsg:
+		text := fmt.Sprintf("%s: broker granted QoS %d, requested %d", msg.Topic, msg.Granted, msg.Requested)
+		if msg.Unsubscribed {
+			a.ui.SetTopicSubscribed(msg.Topic, false)
+			a.ui.SetError(text + ", unsubscribed")
+		} else {
+			a.ui.SetNotice("Warning: " + text)
+		}
+	case SubscribeRequestMsg:
+		if a.mqtt != nil && a.mqtt.IsConnected() {
+			cmds = append(cmds, a.subscribeToTopicCmd(msg.Topic))
+		}
+	case MQTTProtocolFallbackMsg:
+		cmds = append(cmds, a.ui.FlashNotice(fmt.Sprintf("%s doesn't support MQTT 5, using 3.1.1: message properties are unavailable", msg.Broker)))
+	case MQTTQoSConflictMsg:
+		cmds = append(cmds, a.ui.FlashNotice(fmt.Sprintf("%s is already requested at QoS %d, keeping QoS %d", msg.Topic, msg.Previous, msg.Kept)))
+	case PublishRequestMsg:
+		if a.mqtt == nil {
+			a.ui.SetError("Cannot publish: not connected to a broker")
+		} else {
+			cmds = append(cmds, a.publishCmd(msg))
+		}
+	case MQTTPublishedMsg:
+		a.ui.SetError("")
+		cmds = append(cmds, a.ui.FlashNotice(fmt.Sprintf("Published %s to %s", formatBytes(msg.Bytes), msg.Topic)))
 	case MQTTErrorMsg:
-		// Handle MQTT errors
+		// Handle MQTT errors; a failed connection attempt ends the connecting state
+		if a.ui.ConnectionStatus() == StatusConnecting {
+			a.ui.SetConnectionStatus(StatusDisconnected, 0)
+		}
 		a.ui.SetError(fmt.Sprintf("MQTT Error: %v", msg.Error))
 	}
 
@@ -126,31 +679,281 @@ func (a *App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		cmds = append(cmds, uiCmd)
 	}
 
-	// Check for subscription changes
+	// Check for subscription changes; offline they can't be carried out
+	newSubscribed := a.ui.GetSubscribedTopics()
 	if a.mqtt != nil && a.mqtt.IsConnected() {
-		newSubscribed := a.ui.GetSubscribedTopics()
 		cmds = append(cmds, a.handleSubscriptionChanges(oldSubscribed, newSubscribed)...)
+	} else if status := a.ui.ConnectionStatus(); status == StatusOffline || status == StatusDisconnected {
+		slices.Sort(oldSubscribed)
+		slices.Sort(newSubscribed)
+		if !slices.Equal(oldSubscribed, newSubscribed) {
+			a.ui.RestoreSubscriptions(oldSubscribed)
+			a.ui.SetError("Not connected to a broker, press c to connect before subscribing")
+		}
 	}
+	a.persistSubscriptions()
+	cmds = append(cmds, a.ui.TakeErrorExpiry())
 
 	return a, tea.Batch(cmds...)
 }
 
+// quit saves the session, if any, and disconnects before quitting
+func (a *App) quit() tea.Cmd {
+	a.quitting = true
+	a.saveSession()
+	if a.mqtt != nil {
+		return a.disconnectCmd()
+	}
+	return tea.Quit
+}
+
+// confirmQuit answers the save-before-quitting prompt: y exports the
+// messages and quits once they are written, n quits without saving and esc
+// goes back to the interface; other keys are ignored
+func (a *App) confirmQuit(key string) tea.Cmd {
+	switch key {
+	case "y":
+		a.ui.confirmingQuit = false
+		a.savingOnQuit = true
+		a.ui.SetNotice(fmt.Sprintf("Saving messages to %s...", a.ui.exportFile))
+		return a.ui.exportAllCmd(a.ui.exportFile)
+	case "n", "ctrl+c":
+		a.ui.confirmingQuit = false
+		return a.quit()
+	case "esc":
+		a.ui.confirmingQuit = false
+	}
+	return nil
+}
+
+// retryConnect connects again after the MQTT client couldn't be created or
+// its first connection failed; connections lost later reconnect on their own
+func (a *App) retryConnect() tea.Cmd {
+	status := a.ui.ConnectionStatus()
+	if a.replayer != nil || (status != StatusOffline && status != StatusDisconnected) {
+		return nil
+	}
+	if a.mqtt == nil {
+		client, err := NewMQTTClient(a.config)
+		if err != nil {
+			logError("Failed to create MQTT client: %v", err)
+			a.ui.SetError(fmt.Sprintf("MQTT client: %v", err))
+			return nil
+		}
+		client.SetProgram(a.program)
+		a.mqtt = client
+		a.ui.SetError("")
+		a.ui.SetConnectionStatus(StatusConnecting, 0)
+		return client.ConnectCmd()
+	}
+	a.ui.SetError("")
+	a.ui.SetConnectionStatus(StatusConnecting, 0)
+	return a.mqtt.RetryConnectCmd()
+}
+
 // View implements tea.Model
 func (a *App) View() string {
 	if a.quitting {
+		if a.mqtt != nil {
+			if n := a.mqtt.InFlight(); n > 0 {
+				return fmt.Sprintf("\nWaiting for %d in-flight messages... (ctrl+c to quit now)\n", n)
+			}
+		}
 		return "\nDisconnecting from MQTT broker...\nGoodbye!\n"
 	}
 	return a.ui.View()
 }
 
-// getEnvOrDefault returns environment variable value or default
+// disconnectCmd disconnects from the broker, waiting for in-flight messages,
+// and then quits; the shutdown screen is shown meanwhile
+func (a *App) disconnectCmd() tea.Cmd {
+	return func() tea.Msg {
+		a.mqtt.Disconnect()
+		return tea.QuitMsg{}
+	}
+}
+
+// addMessage shows a message and starts its payload transform, if any
+func (a *App) addMessage(message Message) tea.Cmd {
+	return a.addMessages([]Message{message})
+}
+
+// addMessages shows messages and starts their payload transforms, if any
+func (a *App) addMessages(messages []Message) tea.Cmd {
+	// Without discovery, topics are listed as their messages arrive
+	if !a.config.discovers() {
+		for _, message := range messages {
+			a.ui.AddTopic(message.Topic)
+		}
+	}
+	seqs := a.ui.AddMessages(messages)
+	cmds := []tea.Cmd{a.ui.TakeBell()}
+	if a.transformer != nil {
+		for i, message := range messages {
+			message.Seq = seqs[i]
+			cmds = append(cmds, a.transformer.Cmd(message))
+		}
+	}
+	return tea.Batch(cmds...)
+}
+
+// recordRecentBroker remembers the connected broker in the recent brokers history
+func (a *App) recordRecentBroker() {
+	path, err := recentBrokersPath()
+	if err == nil {
+		config := a.config
+		config.ClientID = a.clientIDTemplate
+		err = RecordRecentBroker(path, config)
+	}
+	if err != nil {
+		logError("Failed to update recent brokers: %v", err)
+	}
+}
+
+// flagSettings holds the settings given as command-line flags, keyed by the
+// environment variable they override
+var flagSettings = map[string]string{}
+
+// lookupSetting resolves a setting by its environment variable name: a
+// command-line flag wins over the environment. ok is false when neither sets
+// it, leaving the caller's default.
+func lookupSetting(key string) (value string, ok bool) {
+	if value, ok := flagSettings[key]; ok {
+		return value, true
+	}
+	value = os.Getenv(key)
+	return value, value != ""
+}
+
+// getEnvOrDefault returns the setting's value or default
 func getEnvOrDefault(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
+	if value, ok := lookupSetting(key); ok && value != "" {
 		return value
 	}
 	return defaultValue
 }
 
+// getEnvBool returns environment variable parsed as a bool or default
+func getEnvBool(key string, defaultValue bool) bool {
+	value, _ := lookupSetting(key)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		logError("Invalid value for %s: %q, using default %v", key, value, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
+// getEnvInt returns environment variable parsed as a non-negative integer or default
+func getEnvInt(key string, defaultValue int) int {
+	value, _ := lookupSetting(key)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < 0 {
+		logError("Invalid value for %s: %q, using default %d", key, value, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
+// getEnvQoS returns environment variable parsed as an MQTT QoS level or 0
+func getEnvQoS(key string) byte {
+	value, _ := lookupSetting(key)
+	if value == "" {
+		return 0
+	}
+	qos, err := strconv.Atoi(value)
+	if err != nil || qos < 0 || qos > 2 {
+		logError("Invalid value for %s: %q, must be 0, 1 or 2, using 0", key, value)
+		return 0
+	}
+	return byte(qos)
+}
+
+// getEnvProtocolVersion returns the MQTT protocol level named by an
+// environment variable, 0 to negotiate
+func getEnvProtocolVersion(key string) uint {
+	value, _ := lookupSetting(key)
+	switch value {
+	case "":
+		return 0
+	case "3", "3.1":
+		return 3
+	case "4", "3.1.1":
+		return 4
+	case "5", "5.0":
+		return 5
+	}
+	logError("Invalid value for %s: %q, must be 3.1, 3.1.1 or 5, negotiating", key, value)
+	return 0
+}
+
+// getEnvLogLevel returns the log level named by an environment variable,
+// info by default
+func getEnvLogLevel(key string) LogLevel {
+	value, _ := lookupSetting(key)
+	if value == "" {
+		return LogInfo
+	}
+	level, err := parseLogLevel(value)
+	if err != nil {
+		logError("Invalid value for %s: %q, %v, using info", key, value, err)
+	}
+	return level
+}
+
+// getEnvDuration returns environment variable parsed as a duration or default
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value, _ := lookupSetting(key)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil || parsed < 0 {
+		logError("Invalid value for %s: %q, using default %v", key, value, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
+// getEnvTransforms returns the payload transforms configured in an environment variable
+func getEnvTransforms(key string) []PayloadTransform {
+	value, _ := lookupSetting(key)
+	transforms, err := parseTransforms(value)
+	if err != nil {
+		logError("Invalid value for %s: %v, ignoring transforms", key, err)
+		return nil
+	}
+	return transforms
+}
+
+// getEnvPipeline returns the decode pipeline configured in an environment variable
+func getEnvPipeline(key string) *DecodePipeline {
+	value, _ := lookupSetting(key)
+	pipeline, err := parseDecodePipeline(value)
+	if err != nil {
+		logError("Invalid value for %s: %v, not decoding", key, err)
+		return nil
+	}
+	return pipeline
+}
+
+// getEnvTopicColors returns the topic color rules configured in an environment variable
+func getEnvTopicColors(key string) []TopicColorRule {
+	value, _ := lookupSetting(key)
+	rules, err := parseTopicColors(value)
+	if err != nil {
+		logError("Invalid value for %s: %v, ignoring topic colors", key, err)
+		return nil
+	}
+	return rules
+}
+
 // handleSubscriptionChanges handles topic subscription/unsubscription
 func (a *App) handleSubscriptionChanges(oldSubscribed, newSubscribed []string) []tea.Cmd {
 	var cmds []tea.Cmd
@@ -180,23 +983,75 @@ func (a *App) handleSubscriptionChanges(oldSubscribed, newSubscribed []string) [
 		}
 	}
 
-	return cmds
+	return limitConcurrency(cmds, maxSubscribeWorkers)
+}
+
+// autoSubscribe subscribes to newly discovered topics while auto-subscribe
+// is on
+func (a *App) autoSubscribe(topics []string) []tea.Cmd {
+	if !a.ui.autoSubscribe || len(topics) == 0 || a.mqtt == nil || !a.mqtt.IsConnected() {
+		return nil
+	}
+	oldSubscribed := a.ui.GetSubscribedTopics()
+	a.ui.autoSubscribeTopics(topics)
+	return a.handleSubscriptionChanges(oldSubscribed, a.ui.GetSubscribedTopics())
+}
+
+// maxSubscribeWorkers bounds the subscription requests in flight at once, so
+// bulk changes don't start a goroutine per topic
+const maxSubscribeWorkers = 8
+
+// limitConcurrency spreads cmds over at most n sequences that run side by
+// side, each running its share of the commands one after another
+func limitConcurrency(cmds []tea.Cmd, n int) []tea.Cmd {
+	if len(cmds) <= n {
+		return cmds
+	}
+	lanes := make([][]tea.Cmd, n)
+	for i, cmd := range cmds {
+		lanes[i%n] = append(lanes[i%n], cmd)
+	}
+	sequences := make([]tea.Cmd, n)
+	for i, lane := range lanes {
+		sequences[i] = tea.Sequence(lane...)
+	}
+	return sequences
 }
 
 // subscribeToTopicCmd creates a command to subscribe to a topic
 func (a *App) subscribeToTopicCmd(topic string) tea.Cmd {
+	qos := a.ui.SubscribeQoS()
 	return func() tea.Msg {
-		if err := a.mqtt.SubscribeToTopic(topic); err != nil {
+		if err := a.mqtt.SetSubscribed(topic, true, qos); err != nil {
+			var downgraded *QoSDowngradeError
+			if errors.As(err, &downgraded) {
+				return MQTTSubscriptionDowngradedMsg{
+					Topic:        topic,
+					Requested:    downgraded.Requested,
+					Granted:      downgraded.Granted,
+					Unsubscribed: true,
+				}
+			}
 			return MQTTErrorMsg{Error: fmt.Errorf("failed to subscribe to %s: %v", topic, err)}
 		}
 		return nil
 	}
 }
 
+// publishCmd creates a command to publish a payload to a topic
+func (a *App) publishCmd(req PublishRequestMsg) tea.Cmd {
+	return func() tea.Msg {
+		if err := a.mqtt.PublishToTopic(req.Topic, req.Payload, req.QoS, req.Retained); err != nil {
+			return MQTTErrorMsg{Error: fmt.Errorf("failed to publish to %s: %v", req.Topic, err)}
+		}
+		return MQTTPublishedMsg{Topic: req.Topic, Bytes: len(req.Payload)}
+	}
+}
+
 // unsubscribeFromTopicCmd creates a command to unsubscribe from a topic
 func (a *App) unsubscribeFromTopicCmd(topic string) tea.Cmd {
 	return func() tea.Msg {
-		if err := a.mqtt.UnsubscribeFromTopic(topic); err != nil {
+		if err := a.mqtt.SetSubscribed(topic, false, 0); err != nil {
 			return MQTTErrorMsg{Error: fmt.Errorf("failed to unsubscribe from %s: %v", topic, err)}
 		}
 		return nil
@@ -0,0 +1,123 @@
+package main
+
+import (
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// The smallest panes the renderers handle, and the terminal size they need:
+// the title, status bar and help take five lines, the borders two columns
+const (
+	minTopicsWidth   = 20
+	minMessagesWidth = 30
+	minPaneHeight    = 10
+	minTermWidth     = minTopicsWidth + minMessagesWidth + 2
+	minTermHeight    = minPaneHeight + 5
+)
+
+// tooSmall reports whether the terminal is smaller than the split-pane
+// layout needs
+func (ui *UI) tooSmall() bool {
+	return ui.width < minTermWidth || ui.height < minTermHeight
+}
+
+// paneLayout returns the content widths of the topics and messages panes and
+// their content height, as laid out by View
+func (ui *UI) paneLayout() (topicsWidth, messagesWidth, height int) {
+	// Reserve space for the title, status bar and help
+	height = ui.height - 5
+	if height < minPaneHeight {
+		height = minPaneHeight
+	}
+
+	// 1/3 for topics, 2/3 for messages
+	topicsWidth = ui.width / 3
+	if topicsWidth < minTopicsWidth {
+		topicsWidth = minTopicsWidth
+	}
+	messagesWidth = ui.width - topicsWidth - 2
+	if messagesWidth < minMessagesWidth {
+		messagesWidth = minMessagesWidth
+	}
+	return topicsWidth, messagesWidth, height
+}
+
+// hitTest maps a screen position to the pane under it and the pane's
+// content line, -1 for the pane's title
+func (ui *UI) hitTest(x, y int) (pane Pane, line int, ok bool) {
+	topicsWidth, _, height := ui.paneLayout()
+
+	// Panes start below the title bar; borders add a line or column on
+	// each side, the minimal layout a divider column instead
+	border := 1
+	if ui.minimal {
+		border = 0
+	}
+	top := 1
+	if y < top || y >= top+height+2*border {
+		return TopicsPane, 0, false
+	}
+	line = y - top - border - 1
+	if line >= height-1 {
+		// The bottom border
+		return TopicsPane, 0, false
+	}
+	if line < 0 {
+		line = -1
+	}
+
+	pane = TopicsPane
+	if x >= topicsWidth+2*border {
+		pane = MessagesPane
+	}
+	return pane, line, true
+}
+
+// handleMouse selects the clicked topic or message and scrolls the pane
+// under the wheel. Clicking a topic toggles its subscription like Enter.
+func (ui *UI) handleMouse(msg tea.MouseMsg) (*UI, tea.Cmd) {
+	if ui.CapturesInput() || ui.confirmingQuit || ui.tooSmall() {
+		return ui, nil
+	}
+	pane, line, ok := ui.hitTest(msg.X, msg.Y)
+	if !ok || msg.Action != tea.MouseActionPress {
+		return ui, nil
+	}
+
+	switch msg.Button {
+	case tea.MouseButtonWheelUp, tea.MouseButtonWheelDown:
+		// The wheel moves like the arrow keys in the pane under it
+		ui.activePane = pane
+		key := tea.KeyMsg{Type: tea.KeyUp}
+		if msg.Button == tea.MouseButtonWheelDown {
+			key = tea.KeyMsg{Type: tea.KeyDown}
+		}
+		return ui.handleKeyPress(key)
+	case tea.MouseButtonLeft:
+		ui.activePane = pane
+		if line < 0 {
+			return ui, nil
+		}
+		if pane == TopicsPane {
+			row := ui.topicScroll + line
+			if row >= len(ui.topicKeys()) {
+				return ui, nil
+			}
+			ui.selectedTopic = row
+			if topic, ok := ui.selectedSubscription(); ok {
+				ui.subscribedTopics[topic] = !ui.subscribedTopics[topic]
+			}
+		} else if line < len(ui.messageLines) && ui.messageLines[line] >= 0 {
+			ui.selectedMessage = ui.messageLines[line]
+		}
+	}
+	return ui, nil
+}
+
+// recordMessageLines notes which message each line of a rendered item
+// belongs to, -1 for lines that aren't a message, for mouse hit-testing
+func (ui *UI) recordMessageLines(item string, index int) {
+	for range lipgloss.Height(item) {
+		ui.messageLines = append(ui.messageLines, index)
+	}
+}
@@ -1,8 +1,18 @@
 package main
 
 import (
-	"log"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
@@ -10,27 +20,178 @@ import (
 )
 
 // MQTT Message types for Bubble Tea
-type MQTTConnectedMsg struct{}
-type MQTTDisconnectedMsg struct{}
+type MQTTConnectedMsg struct {
+	// Broker is the address of the broker the client connected to
+	Broker string
+	// Reconnect is set when paho re-established a dropped connection
+	Reconnect bool
+}
+type MQTTDisconnectedMsg struct {
+	// Reason describes why the connection ended; MQTT 5 brokers report it
+	// as a DISCONNECT reason code, older protocol versions only as an error
+	Reason string
+}
+type MQTTReconnectingMsg struct {
+	// Attempt counts the reconnection attempts since the connection was lost
+	Attempt int
+}
 type MQTTTopicsDiscoveredMsg struct {
 	Topics []string
 }
+
+// MQTTProtocolFallbackMsg reports that the broker refused MQTT 5 and the
+// client falls back to 3.1.1, without message properties
+type MQTTProtocolFallbackMsg struct {
+	Broker string
+}
+
+// MQTTTopicDiscoveredMsg reports a topic seen for the first time by discovery
+type MQTTTopicDiscoveredMsg struct {
+	Topic string
+}
 type MQTTMessageMsg struct {
 	Topic     string
 	Payload   string
+	Raw       []byte
+	QoS       byte
 	Timestamp time.Time
+	// Queued is set for messages the broker held for a persistent session
+	// while we were disconnected and delivered right after reconnecting
+	Queued bool
+	// Retained is set for the broker's stored message of a topic, delivered
+	// when subscribing rather than published live
+	Retained bool
+	// Properties are the MQTT 5 properties sent with the message, if any
+	Properties *MessageProperties
+}
+
+// Message converts a received message for the UI
+func (msg MQTTMessageMsg) Message() Message {
+	return Message{
+		Topic:      msg.Topic,
+		Payload:    msg.Payload,
+		Raw:        msg.Raw,
+		QoS:        msg.QoS,
+		Timestamp:  msg.Timestamp,
+		Queued:     msg.Queued,
+		Retained:   msg.Retained,
+		Properties: msg.Properties,
+	}
+}
+
+// MQTTMessagesMsg delivers the messages received during one flush interval
+// at once, so a flood costs one redraw per interval rather than per message
+type MQTTMessagesMsg struct {
+	Messages []Message
+}
+
+type MQTTPublishedMsg struct {
+	Topic string
+	Bytes int
 }
 type MQTTErrorMsg struct {
 	Error error
 }
+type MQTTResubscribedMsg struct {
+	Restored int
+	Total    int
+	Failed   []string
+}
+type MQTTSubscriptionDowngradedMsg struct {
+	Topic     string
+	Requested byte
+	Granted   byte
+	// Unsubscribed is set when the downgrade policy rejected the subscription
+	Unsubscribed bool
+}
+
+// MQTTQoSConflictMsg reports a subscription requested at another QoS than
+// the same filter already has. A second SUBSCRIBE would quietly replace the
+// first one's QoS, so the higher of the two is kept instead.
+type MQTTQoSConflictMsg struct {
+	Topic     string
+	Requested byte
+	Previous  byte
+	Kept      byte
+}
+
+// QoSDowngradeError is returned for a subscription the broker granted at a
+// lower QoS than requested when the downgrade policy is "error"
+type QoSDowngradeError struct {
+	Topic     string
+	Requested byte
+	Granted   byte
+}
+
+func (e *QoSDowngradeError) Error() string {
+	return fmt.Sprintf("broker granted QoS %d for %s, requested %d", e.Granted, e.Topic, e.Requested)
+}
+
+// subackFailure is the SUBACK return code for a rejected subscription
+const subackFailure = 0x80
+
+// duplicateWindow is how long a delivered message is remembered to drop the
+// extra copies a broker may send for overlapping subscriptions (e.g.
+// sensors/# and sensors/temp)
+const duplicateWindow = 100 * time.Millisecond
+
+// catchUpGap ends the burst of queued messages a persistent session delivers
+// after a reconnect: the first pause this long means we are back to live traffic
+const catchUpGap = 250 * time.Millisecond
 
 // MQTTClient wraps the MQTT functionality
 type MQTTClient struct {
 	client           mqtt.Client
+	opts             *mqtt.ClientOptions
 	config           Config
 	discoveredTopics map[string]bool
 	topicsMutex      sync.RWMutex
 	program          *tea.Program
+	connectedOnce    bool
+	reconnectAttempt atomic.Int32
+	bridge           *Bridge
+	inFlight         inFlightTracker
+	broker           atomic.Value // string, last broker a connection was attempted to
+	capture          *CaptureWriter
+	captureFile      *os.File
+
+	// lastActivity is when the broker last sent something, in Unix
+	// nanoseconds, for the stall watchdog
+	lastActivity atomic.Int64
+
+	// Messages and payload bytes received, for the throughput summary
+	receivedCount atomic.Uint64
+	receivedBytes atomic.Uint64
+
+	recentMutex sync.Mutex
+	recent      map[messageKey]time.Time
+
+	// Messages waiting for the next flush to the program
+	pendingMutex sync.Mutex
+	pending      []Message
+
+	// discovering is set once discovery's # subscription is made
+	discovering atomic.Bool
+
+	// done is closed by Disconnect to stop the flush loop
+	done     chan struct{}
+	doneOnce sync.Once
+
+	// sink receives messages instead of the program when running headless
+	sink func(Message)
+
+	// Catch-up state after a reconnect with a persistent session
+	catchUpMutex sync.Mutex
+	catchingUp   bool
+	lastCatchUp  time.Time
+
+	// Subscription state, serialized per topic so the last request wins
+	subsMutex      sync.Mutex
+	wantSubscribed map[string]bool
+	wantQoS        map[string]byte
+	isSubscribed   map[string]bool
+	subscribedQoS  map[string]byte
+	subsBusy       map[string]bool
 }
 
 // NewMQTTClient creates a new MQTT client
@@ -38,12 +199,41 @@ func NewMQTTClient(config Config) (*MQTTClient, error) {
 	client := &MQTTClient{
 		config:           config,
 		discoveredTopics: make(map[string]bool),
+		wantSubscribed:   make(map[string]bool),
+		wantQoS:          make(map[string]byte),
+		isSubscribed:     make(map[string]bool),
+		subscribedQoS:    make(map[string]byte),
+		subsBusy:         make(map[string]bool),
+		recent:           make(map[messageKey]time.Time),
+		done:             make(chan struct{}),
 	}
 
-	// Set up MQTT client options
+	// Set up MQTT client options; paho tries the brokers in order and fails over
 	opts := mqtt.NewClientOptions()
-	opts.AddBroker(config.BrokerURL)
+	useTLS := false
+	for _, broker := range brokerURLs(config.BrokerURL) {
+		opts.AddBroker(broker)
+		useTLS = useTLS || isTLSBroker(broker)
+	}
 	opts.SetClientID(config.ClientID)
+	opts.SetConnectTimeout(config.ConnectTimeout)
+	opts.SetKeepAlive(config.KeepAlive)
+	opts.SetCleanSession(config.CleanSession)
+	if config.ProtocolVersion != 0 {
+		opts.SetProtocolVersion(config.ProtocolVersion)
+	}
+
+	// Keep retrying a dropped connection, backing off up to the interval
+	opts.SetAutoReconnect(true)
+	opts.SetMaxReconnectInterval(config.MaxReconnectInterval)
+
+	if useTLS {
+		tlsConfig, err := newTLSConfig(config)
+		if err != nil {
+			return nil, err
+		}
+		opts.SetTLSConfig(tlsConfig)
+	}
 
 	if config.Username != "" {
 		opts.SetUsername(config.Username)
@@ -53,28 +243,148 @@ func NewMQTTClient(config Config) (*MQTTClient, error) {
 	}
 
 	// Set connection handlers
-	opts.SetDefaultPublishHandler(client.messageHandler)
+	opts.SetDefaultPublishHandler(client.publishHandler)
 	opts.SetOnConnectHandler(client.connectHandler)
 	opts.SetConnectionLostHandler(client.connectionLostHandler)
+	opts.SetReconnectingHandler(client.reconnectingHandler)
+	opts.SetConnectionAttemptHandler(func(broker *url.URL, tlsCfg *tls.Config) *tls.Config {
+		client.broker.Store(broker.String())
+		return tlsCfg
+	})
+
+	// Create the MQTT client; MQTT 5 takes the same options through paho.golang
+	client.opts = opts
+	if config.ProtocolVersion == 5 {
+		client.client = newV5Client(opts)
+	} else {
+		client.client = mqtt.NewClient(opts)
+	}
 
-	// Create the MQTT client
-	client.client = mqtt.NewClient(opts)
+	// Optionally record every received message
+	if config.CaptureFile != "" {
+		file, err := os.Create(config.CaptureFile)
+		if err != nil {
+			return nil, fmt.Errorf("creating capture file: %v", err)
+		}
+		capture, err := NewCaptureWriter(file)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("writing capture header: %v", err)
+		}
+		client.capture = capture
+		client.captureFile = file
+	}
+
+	// Optionally forward matching messages elsewhere
+	if config.BridgeFilter != "" {
+		bridge, err := NewBridge(config, client.client, &client.inFlight)
+		if err != nil {
+			return nil, err
+		}
+		client.bridge = bridge
+	}
 
 	return client, nil
 }
 
-// SetProgram sets the Bubble Tea program for sending messages
+// SetProgram sets the Bubble Tea program for sending messages and starts
+// flushing received messages to it
 func (m *MQTTClient) SetProgram(p *tea.Program) {
 	m.program = p
+	if m.config.FlushInterval > 0 {
+		go m.flushLoop(m.config.FlushInterval)
+	}
+}
+
+// SetMessageSink hands every received message to sink rather than to a
+// program; it must be set before connecting
+func (m *MQTTClient) SetMessageSink(sink func(Message)) {
+	m.sink = sink
+}
+
+// flushLoop sends the messages received since the last tick as one batch
+// until the client disconnects
+func (m *MQTTClient) flushLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-ticker.C:
+		}
+		m.pendingMutex.Lock()
+		batch := m.pending
+		m.pending = nil
+		m.pendingMutex.Unlock()
+		if len(batch) > 0 {
+			m.program.Send(MQTTMessagesMsg{Messages: batch})
+		}
+	}
+}
+
+// deliver hands a received message to the program, straight away or with
+// the next flush
+func (m *MQTTClient) deliver(msg MQTTMessageMsg) {
+	if m.config.FlushInterval <= 0 {
+		m.program.Send(msg)
+		return
+	}
+	m.pendingMutex.Lock()
+	m.pending = append(m.pending, msg.Message())
+	m.pendingMutex.Unlock()
+}
+
+// connect connects to the MQTT broker, blocking until it succeeds or fails
+func (m *MQTTClient) connect() error {
+	logDebug("Connecting to %s", m.config.BrokerURL)
+	token := m.client.Connect()
+
+	// paho applies the timeout to each broker in turn, so the attempt as a
+	// whole gets one timeout per broker
+	timeout := m.config.ConnectTimeout * time.Duration(len(brokerURLs(m.config.BrokerURL)))
+	if timeout <= 0 {
+		token.Wait()
+	} else if !token.WaitTimeout(timeout) {
+		return fmt.Errorf("connection to %s timed out after %s", m.config.BrokerURL, timeout)
+	}
+	if errors.Is(token.Error(), errV5Unsupported) {
+		return m.fallBackToV311()
+	}
+	return token.Error()
+}
+
+// fallBackToV311 replaces the MQTT 5 client, which the broker refused, with
+// a 3.1.1 one on the same options and connects with it. Nothing has been
+// connected yet, so nothing else holds the old client.
+func (m *MQTTClient) fallBackToV311() error {
+	broker := m.Broker()
+	logInfo("%s doesn't support MQTT 5, falling back to 3.1.1", broker)
+	m.opts.SetProtocolVersion(4)
+	m.config.ProtocolVersion = 4
+	m.client = mqtt.NewClient(m.opts)
+	if m.program != nil {
+		m.program.Send(MQTTProtocolFallbackMsg{Broker: broker})
+	}
+	return m.connect()
 }
 
 // ConnectCmd returns a command to connect to the MQTT broker
 func (m *MQTTClient) ConnectCmd() tea.Cmd {
+	if m.bridge != nil {
+		return tea.Batch(m.RetryConnectCmd(), m.bridge.ConnectCmd())
+	}
+	return m.RetryConnectCmd()
+}
+
+// RetryConnectCmd returns a command to connect to the MQTT broker again after
+// the first attempt failed; the bridge keeps the connection it has
+func (m *MQTTClient) RetryConnectCmd() tea.Cmd {
 	return func() tea.Msg {
-		if token := m.client.Connect(); token.Wait() && token.Error() != nil {
-			return MQTTErrorMsg{Error: token.Error()}
+		if err := m.connect(); err != nil {
+			return MQTTErrorMsg{Error: err}
 		}
-		return MQTTConnectedMsg{}
+		return MQTTConnectedMsg{Broker: m.Broker()}
 	}
 }
 
@@ -82,13 +392,14 @@ func (m *MQTTClient) ConnectCmd() tea.Cmd {
 func (m *MQTTClient) DiscoverTopicsCmd() tea.Cmd {
 	return func() tea.Msg {
 		// Subscribe to all topics to discover them
-		if token := m.client.Subscribe("#", 0, m.discoveryHandler); token.Wait() && token.Error() != nil {
+		m.discovering.Store(true)
+		if token := m.client.Subscribe("#", m.config.QoS, nil); token.Wait() && token.Error() != nil {
+			m.discovering.Store(false)
 			return MQTTErrorMsg{Error: token.Error()}
 		}
 
-		// Wait a bit to collect topics, then return discovered topics
-		time.Sleep(2 * time.Second)
-
+		// Report the topics known so far; discoveryHandler streams the rest
+		// as they are first seen
 		m.topicsMutex.RLock()
 		topics := make([]string, 0, len(m.discoveredTopics))
 		for topic := range m.discoveredTopics {
@@ -100,9 +411,170 @@ func (m *MQTTClient) DiscoverTopicsCmd() tea.Cmd {
 	}
 }
 
+// ForgetTopics drops topics from the discovered ones, so discovery reports
+// them again when they next see a message; no topics forgets them all
+func (m *MQTTClient) ForgetTopics(topics []string) {
+	m.topicsMutex.Lock()
+	defer m.topicsMutex.Unlock()
+	if len(topics) == 0 {
+		clear(m.discoveredTopics)
+		return
+	}
+	for _, topic := range topics {
+		delete(m.discoveredTopics, topic)
+	}
+}
+
 // SubscribeToTopic subscribes to a specific topic
-func (m *MQTTClient) SubscribeToTopic(topic string) error {
-	if token := m.client.Subscribe(topic, 0, m.messageHandler); token.Wait() && token.Error() != nil {
+func (m *MQTTClient) SubscribeToTopic(topic string, qos byte) error {
+	token := m.client.Subscribe(topic, qos, nil)
+	if token.Wait() && token.Error() != nil {
+		return token.Error()
+	}
+	sub, ok := token.(subscribeResult)
+	if !ok {
+		return nil
+	}
+	granted := sub.Result()[topic]
+	if granted == subackFailure {
+		return fmt.Errorf("subscription to %s rejected by broker", topic)
+	}
+	if granted < qos {
+		return m.handleDowngrade(topic, qos, granted)
+	}
+	return nil
+}
+
+// handleDowngrade applies the QoS downgrade policy to a subscription the
+// broker granted at a lower QoS than requested: "accept" keeps it quietly,
+// "warn" keeps it and tells the user, "error" unsubscribes again
+func (m *MQTTClient) handleDowngrade(topic string, requested, granted byte) error {
+	logInfo("Broker granted QoS %d for %s, requested %d", granted, topic, requested)
+	switch m.config.QoSDowngrade {
+	case "accept":
+		return nil
+	case "error":
+		if err := m.UnsubscribeFromTopic(topic); err != nil {
+			logError("Failed to unsubscribe from downgraded %s: %v", topic, err)
+		}
+		return &QoSDowngradeError{Topic: topic, Requested: requested, Granted: granted}
+	default:
+		if m.program != nil {
+			m.program.Send(MQTTSubscriptionDowngradedMsg{Topic: topic, Requested: requested, Granted: granted})
+		}
+		return nil
+	}
+}
+
+// resubscribe restores the subscriptions held before a reconnect. With
+// verification enabled each SUBACK is checked and failures are reported,
+// otherwise subscriptions are sent without waiting for the broker.
+func (m *MQTTClient) resubscribe() MQTTResubscribedMsg {
+	m.subsMutex.Lock()
+	var topics []string
+	qos := make(map[string]byte)
+	for topic, subscribed := range m.isSubscribed {
+		if subscribed {
+			topics = append(topics, topic)
+			qos[topic] = m.wantQoS[topic]
+		}
+	}
+	m.subsMutex.Unlock()
+	sort.Strings(topics)
+
+	result := MQTTResubscribedMsg{Total: len(topics)}
+	for _, topic := range topics {
+		if !m.config.VerifyResubscribe {
+			m.client.Subscribe(topic, qos[topic], nil)
+			result.Restored++
+			continue
+		}
+		if err := m.SubscribeToTopic(topic, qos[topic]); err != nil {
+			logError("Failed to restore subscription to %s: %v", topic, err)
+			result.Failed = append(result.Failed, topic)
+			continue
+		}
+		result.Restored++
+	}
+	return result
+}
+
+// SetSubscribed records whether a topic should be subscribed and applies it.
+// Requests for the same topic are serialized: if another call is already
+// working on the topic it picks up the new state, so rapid toggling always
+// converges to the most recently requested state. qos is the QoS requested
+// when subscribing; asking for a subscription already requested at another
+// QoS keeps the higher of the two and reports the conflict.
+func (m *MQTTClient) SetSubscribed(topic string, subscribed bool, qos byte) error {
+	m.subsMutex.Lock()
+	var conflict *MQTTQoSConflictMsg
+	if subscribed && m.wantSubscribed[topic] && m.wantQoS[topic] != qos {
+		previous := m.wantQoS[topic]
+		conflict = &MQTTQoSConflictMsg{Topic: topic, Requested: qos, Previous: previous, Kept: max(previous, qos)}
+		qos = conflict.Kept
+	}
+	m.wantSubscribed[topic] = subscribed
+	if subscribed {
+		m.wantQoS[topic] = qos
+	}
+	if conflict != nil {
+		logInfo("%s requested at QoS %d and %d, keeping QoS %d", topic, conflict.Previous, conflict.Requested, conflict.Kept)
+		// Sent on the way out, not while holding the lock
+		if m.program != nil {
+			defer m.program.Send(*conflict)
+		}
+	}
+	if m.subsBusy[topic] {
+		m.subsMutex.Unlock()
+		return nil
+	}
+	m.subsBusy[topic] = true
+
+	for {
+		want := m.wantSubscribed[topic]
+		qos := m.wantQoS[topic]
+		// A kept higher QoS means subscribing again, which replaces the old one
+		if want == m.isSubscribed[topic] && (!want || m.subscribedQoS[topic] == qos) {
+			delete(m.subsBusy, topic)
+			m.subsMutex.Unlock()
+			return nil
+		}
+		m.subsMutex.Unlock()
+
+		var err error
+		if want {
+			logDebug("Subscribing to %s at QoS %d", topic, qos)
+			err = m.SubscribeToTopic(topic, qos)
+		} else {
+			logDebug("Unsubscribing from %s", topic)
+			err = m.UnsubscribeFromTopic(topic)
+		}
+
+		m.subsMutex.Lock()
+		if err != nil {
+			delete(m.subsBusy, topic)
+			m.subsMutex.Unlock()
+			return err
+		}
+		m.isSubscribed[topic] = want
+		if want {
+			m.subscribedQoS[topic] = qos
+		}
+	}
+}
+
+// PublishToTopic publishes a payload and waits for the broker to acknowledge
+// it at the requested QoS
+func (m *MQTTClient) PublishToTopic(topic, payload string, qos byte, retained bool) error {
+	if m.client == nil || !m.client.IsConnected() {
+		return fmt.Errorf("not connected to a broker")
+	}
+	if err := validateTopicName(topic); err != nil {
+		return err
+	}
+	token := m.client.Publish(topic, qos, retained, payload)
+	m.inFlight.track(token, nil)
+	if token.Wait() && token.Error() != nil {
 		return token.Error()
 	}
 	return nil
@@ -116,9 +588,72 @@ func (m *MQTTClient) UnsubscribeFromTopic(topic string) error {
 	return nil
 }
 
-// Disconnect disconnects from the MQTT broker
+// unsubscribeTimeout bounds the wait for the broker to acknowledge the
+// unsubscribe sent when quitting
+const unsubscribeTimeout = 2 * time.Second
+
+// unsubscribeAll drops every subscription, discovery's # included, so the
+// broker keeps no orphaned subscriptions for this client. Errors and a slow
+// broker are logged; quitting goes ahead regardless.
+func (m *MQTTClient) unsubscribeAll() {
+	// Brokers that refuse # may not take unsubscribing from it well either
+	var topics []string
+	if m.config.discovers() {
+		topics = append(topics, "#")
+	}
+	m.subsMutex.Lock()
+	for topic, subscribed := range m.isSubscribed {
+		if subscribed && !slices.Contains(topics, topic) {
+			topics = append(topics, topic)
+		}
+	}
+	m.subsMutex.Unlock()
+	if len(topics) == 0 {
+		return
+	}
+
+	token := m.client.Unsubscribe(topics...)
+	if !token.WaitTimeout(unsubscribeTimeout) {
+		logError("Gave up waiting for the broker to confirm unsubscribing from %d topics", len(topics))
+	} else if err := token.Error(); err != nil {
+		logError("Failed to unsubscribe before disconnecting: %v", err)
+	}
+}
+
+// Disconnect unsubscribes from everything and disconnects from the MQTT broker
 func (m *MQTTClient) Disconnect() {
-	m.client.Disconnect(250)
+	// Let QoS 1/2 publishes finish their handshakes before going away
+	if m.config.InFlightTimeout > 0 && !m.inFlight.wait(m.config.InFlightTimeout) {
+		logError("Gave up waiting for %d in-flight messages", m.inFlight.count())
+	}
+	if m.bridge != nil {
+		m.bridge.Disconnect(m.config.DisconnectQuiesce)
+	}
+	// A persistent session is kept on purpose, subscriptions and all
+	if m.client.IsConnectionOpen() && m.config.CleanSession {
+		m.unsubscribeAll()
+	}
+	m.client.Disconnect(uint(m.config.DisconnectQuiesce.Milliseconds()))
+	m.doneOnce.Do(func() { close(m.done) })
+	if m.captureFile != nil {
+		m.captureFile.Close()
+	}
+}
+
+// InFlight returns how many publishes are still waiting for their delivery to complete
+func (m *MQTTClient) InFlight() int {
+	return m.inFlight.count()
+}
+
+// Received returns how many messages and payload bytes have been received
+func (m *MQTTClient) Received() (messages, bytes uint64) {
+	return m.receivedCount.Load(), m.receivedBytes.Load()
+}
+
+// Broker returns the broker most recently connected (or being connected) to
+func (m *MQTTClient) Broker() string {
+	broker, _ := m.broker.Load().(string)
+	return broker
 }
 
 // IsConnected returns true if connected to the broker
@@ -128,38 +663,365 @@ func (m *MQTTClient) IsConnected() bool {
 
 // Message handlers
 func (m *MQTTClient) connectHandler(client mqtt.Client) {
-	log.Println("Connected to MQTT broker")
-	if m.program != nil {
-		m.program.Send(MQTTConnectedMsg{})
+	logInfo("Connected to MQTT broker %s", m.Broker())
+	m.noteActivity()
+	reconnect := m.connectedOnce
+	m.connectedOnce = true
+	m.reconnectAttempt.Store(0)
+
+	// Restoration runs in a fixed order: explicit subscriptions are restored
+	// first, and only once they are (re)issued is the connection reported,
+	// which is what starts discovery. Discovery's # therefore never gets
+	// ahead of an explicit subscription, and the broker forgets them all
+	// with a clean session anyway.
+	var resubscribed MQTTResubscribedMsg
+	if reconnect {
+		m.startCatchUpTimer()
+		resubscribed = m.resubscribe()
+	}
+
+	// The initial connection is reported by ConnectCmd
+	if m.program != nil && reconnect {
+		m.program.Send(MQTTConnectedMsg{Broker: m.Broker(), Reconnect: true})
+		if resubscribed.Total > 0 {
+			m.program.Send(resubscribed)
+		}
 	}
 }
 
 func (m *MQTTClient) connectionLostHandler(client mqtt.Client, err error) {
-	log.Printf("Connection lost: %v", err)
+	logInfo("Connection lost: %v", err)
+
+	// A persistent session makes the broker queue QoS 1/2 messages until we are back
+	if opts := client.OptionsReader(); !opts.CleanSession() {
+		m.catchUpMutex.Lock()
+		m.catchingUp = true
+		m.lastCatchUp = time.Time{}
+		m.catchUpMutex.Unlock()
+	}
+
 	if m.program != nil {
-		m.program.Send(MQTTErrorMsg{Error: err})
+		m.program.Send(MQTTDisconnectedMsg{Reason: disconnectReason(err)})
 	}
 }
 
-func (m *MQTTClient) messageHandler(client mqtt.Client, msg mqtt.Message) {
+// reconnectingHandler is called by paho before each attempt to restore a
+// dropped connection
+func (m *MQTTClient) reconnectingHandler(client mqtt.Client, opts *mqtt.ClientOptions) {
+	attempt := int(m.reconnectAttempt.Add(1))
+	logInfo("Reconnecting (attempt %d)", attempt)
 	if m.program != nil {
-		m.program.Send(MQTTMessageMsg{
+		m.program.Send(MQTTReconnectingMsg{Attempt: attempt})
+	}
+}
+
+// publishHandler receives every message. Subscriptions are made without
+// handlers of their own, so a message matching several filters, discovery's
+// # included, arrives here once per PUBLISH rather than once per filter.
+func (m *MQTTClient) publishHandler(client mqtt.Client, msg mqtt.Message) {
+	if m.discovering.Load() {
+		m.discoveryHandler(client, msg)
+		return
+	}
+	m.messageHandler(client, msg)
+}
+
+func (m *MQTTClient) messageHandler(client mqtt.Client, msg mqtt.Message) {
+	m.noteActivity()
+	received := time.Now()
+	if m.overlapping(msg.Topic()) && m.isDuplicate(msg, received) {
+		return
+	}
+	m.receivedCount.Add(1)
+	m.receivedBytes.Add(uint64(len(msg.Payload())))
+	if m.bridge != nil {
+		m.bridge.Forward(msg)
+	}
+	if m.capture != nil {
+		err := m.capture.Write(CaptureRecord{
 			Topic:     msg.Topic(),
-			Payload:   string(msg.Payload()),
-			Timestamp: time.Now(),
+			Payload:   msg.Payload(),
+			QoS:       msg.Qos(),
+			Retained:  msg.Retained(),
+			Timestamp: received,
 		})
+		if err != nil {
+			logError("Failed to capture message on %s: %v", msg.Topic(), err)
+		}
+	}
+	if m.program == nil && m.sink == nil {
+		return
+	}
+	delivered := MQTTMessageMsg{
+		Topic:     msg.Topic(),
+		Payload:   string(msg.Payload()),
+		Raw:       msg.Payload(),
+		QoS:       msg.Qos(),
+		Timestamp: received,
+		Queued:    m.isQueuedDelivery(msg, received),
+		Retained:  msg.Retained(),
 	}
+	if withProps, ok := msg.(messageWithProperties); ok {
+		delivered.Properties = withProps.Properties()
+	}
+	if m.sink != nil {
+		m.sink(delivered.Message())
+		return
+	}
+	m.deliver(delivered)
 }
 
 func (m *MQTTClient) discoveryHandler(client mqtt.Client, msg mqtt.Message) {
+	m.noteActivity()
 	topic := msg.Topic()
 
 	m.topicsMutex.Lock()
+	known := m.discoveredTopics[topic]
 	m.discoveredTopics[topic] = true
 	m.topicsMutex.Unlock()
 
-	// Also handle as regular message
-	m.messageHandler(client, msg)
+	if !known && m.program != nil {
+		m.program.Send(MQTTTopicDiscoveredMsg{Topic: topic})
+	}
+
+	// Discovery only collects topic names unless its traffic is wanted in the
+	// message pane or the topic has an explicit subscription
+	if m.config.ShowDiscoveryMessages || m.explicitlySubscribed(topic) {
+		m.messageHandler(client, msg)
+	}
+}
+
+// explicitlySubscribed reports whether a topic matches one of the user's subscriptions
+func (m *MQTTClient) explicitlySubscribed(topic string) bool {
+	return m.matchingSubscriptions(topic) > 0
+}
+
+// overlapping reports whether a topic matches more than one subscription,
+// discovery's # included, so the broker may deliver it more than once
+func (m *MQTTClient) overlapping(topic string) bool {
+	matched := m.matchingSubscriptions(topic)
+	if m.discovering.Load() {
+		matched++
+	}
+	return matched > 1
+}
+
+// matchingSubscriptions counts the user's subscriptions matching a topic,
+// including ones whose SUBACK is still due: the broker may send their
+// retained messages first
+func (m *MQTTClient) matchingSubscriptions(topic string) int {
+	m.subsMutex.Lock()
+	defer m.subsMutex.Unlock()
+	matched := 0
+	for filter, wanted := range m.wantSubscribed {
+		if (wanted || m.isSubscribed[filter]) && topicMatches(filter, topic) {
+			matched++
+		}
+	}
+	return matched
+}
+
+// startCatchUpTimer starts timing the queued-message burst once reconnected,
+// so a session with nothing queued ends the catch-up after one gap
+func (m *MQTTClient) startCatchUpTimer() {
+	m.catchUpMutex.Lock()
+	defer m.catchUpMutex.Unlock()
+	if m.catchingUp && m.lastCatchUp.IsZero() {
+		m.lastCatchUp = time.Now()
+	}
+}
+
+// isQueuedDelivery reports whether a message belongs to the burst of queued
+// messages delivered after a reconnect; only QoS 1/2 messages are queued and
+// the burst ends at the first pause of catchUpGap
+func (m *MQTTClient) isQueuedDelivery(msg mqtt.Message, received time.Time) bool {
+	m.catchUpMutex.Lock()
+	defer m.catchUpMutex.Unlock()
+	if !m.catchingUp {
+		return false
+	}
+	if msg.Qos() == 0 || (!m.lastCatchUp.IsZero() && received.Sub(m.lastCatchUp) > catchUpGap) {
+		m.catchingUp = false
+		return false
+	}
+	m.lastCatchUp = received
+	return true
+}
+
+// inFlightTracker counts publishes whose delivery hasn't completed yet, so
+// quitting can wait for QoS 1/2 handshakes instead of cutting them off
+type inFlightTracker struct {
+	wg      sync.WaitGroup
+	pending atomic.Int64
+}
+
+// track waits for a publish token in the background and calls done with its result
+func (t *inFlightTracker) track(token mqtt.Token, done func(err error)) {
+	t.wg.Add(1)
+	t.pending.Add(1)
+	go func() {
+		defer t.wg.Done()
+		defer t.pending.Add(-1)
+		token.Wait()
+		if done != nil {
+			done(token.Error())
+		}
+	}()
+}
+
+// count returns the number of publishes still in flight
+func (t *inFlightTracker) count() int {
+	return int(t.pending.Load())
+}
+
+// wait blocks until all tracked publishes complete or the timeout passes,
+// reporting whether they completed
+func (t *inFlightTracker) wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// messageKey identifies a delivered message for duplicate detection; the
+// packet id only tells QoS 1/2 messages apart, QoS 0 ones have none
+type messageKey struct {
+	topic    string
+	payload  uint64
+	retained bool
+	qos      byte
+	id       uint16
+}
+
+// isDuplicate reports whether the same message (topic, payload, retained
+// flag, QoS and packet id) was already handled within duplicateWindow.
+// Brokers may deliver once per matching subscription, so it is only asked
+// for topics matching overlapping filters; with a single subscription an
+// identical message is a real repeat.
+func (m *MQTTClient) isDuplicate(msg mqtt.Message, now time.Time) bool {
+	hash := fnv.New64a()
+	hash.Write(msg.Payload())
+	key := messageKey{topic: msg.Topic(), payload: hash.Sum64(), retained: msg.Retained(), qos: msg.Qos()}
+	if msg.Qos() > 0 {
+		key.id = msg.MessageID()
+	}
+
+	m.recentMutex.Lock()
+	defer m.recentMutex.Unlock()
+
+	if seen, ok := m.recent[key]; ok && now.Sub(seen) < duplicateWindow {
+		return true
+	}
+	m.recent[key] = now
+
+	// Forget old entries so the map stays small under steady traffic
+	if len(m.recent) > 1000 {
+		for k, seen := range m.recent {
+			if now.Sub(seen) >= duplicateWindow {
+				delete(m.recent, k)
+			}
+		}
+	}
+	return false
+}
+
+// brokerURLs splits a comma-separated broker list
+func brokerURLs(list string) []string {
+	var urls []string
+	for _, broker := range strings.Split(list, ",") {
+		if broker = strings.TrimSpace(broker); broker != "" {
+			urls = append(urls, broker)
+		}
+	}
+	return urls
+}
+
+// topicMatches reports whether a topic matches an MQTT topic filter with
+// + (single level) and # (multi level) wildcards
+func topicMatches(filter, topic string) bool {
+	// Wildcards at the first level don't match $-prefixed system topics
+	if strings.HasPrefix(topic, "$") && (strings.HasPrefix(filter, "+") || strings.HasPrefix(filter, "#")) {
+		return false
+	}
+
+	filterLevels := strings.Split(filter, "/")
+	topicLevels := strings.Split(topic, "/")
+	for i, level := range filterLevels {
+		if level == "#" {
+			return true
+		}
+		if i >= len(topicLevels) {
+			return false
+		}
+		if level != "+" && level != topicLevels[i] {
+			return false
+		}
+	}
+	return len(filterLevels) == len(topicLevels)
+}
+
+// validateTopicFilter checks a subscription filter's syntax: + must fill a
+// whole level and # must fill the last one
+func validateTopicFilter(filter string) error {
+	if filter == "" {
+		return errors.New("empty topic filter")
+	}
+	if strings.ContainsRune(filter, 0) {
+		return errors.New("topic filter contains a NUL character")
+	}
+	levels := strings.Split(filter, "/")
+	for i, level := range levels {
+		if strings.Contains(level, "#") && (level != "#" || i != len(levels)-1) {
+			return fmt.Errorf("# must be the whole last level in %q", filter)
+		}
+		if strings.Contains(level, "+") && level != "+" {
+			return fmt.Errorf("+ must be a whole level in %q", filter)
+		}
+	}
+	return nil
+}
+
+// validateTopicName checks a topic to publish to: unlike a filter it can't
+// contain wildcards, and brokers disconnect clients that publish one
+func validateTopicName(topic string) error {
+	if topic == "" {
+		return errors.New("empty topic")
+	}
+	if strings.ContainsRune(topic, 0) {
+		return errors.New("topic contains a NUL character")
+	}
+	if strings.ContainsAny(topic, "+#") {
+		return fmt.Errorf("can't publish to %q, wildcards are only for subscribing", topic)
+	}
+	return nil
+}
+
+// disconnectReason turns a connection-lost error into a readable reason
+func disconnectReason(err error) string {
+	if err == nil {
+		return "connection lost"
+	}
+	if errors.Is(err, io.EOF) {
+		return "connection closed by broker"
+	}
+	return err.Error()
+}
+
+// AddDiscoveredTopics records topics known from elsewhere, such as a saved
+// session, so discovery results include them
+func (m *MQTTClient) AddDiscoveredTopics(topics []string) {
+	m.topicsMutex.Lock()
+	defer m.topicsMutex.Unlock()
+	for _, topic := range topics {
+		m.discoveredTopics[topic] = true
+	}
 }
 
 // GetDiscoveredTopics returns a list of discovered topics
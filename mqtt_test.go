@@ -0,0 +1,234 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.golang/paho"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// fakeClient is an mqtt.Client that records subscriptions like a broker.
+// Subscribes and unsubscribes wait for hold to be closed, so a test can
+// pile up requests while one is in flight.
+type fakeClient struct {
+	hold chan struct{}
+
+	mutex      sync.Mutex
+	subscribed map[string]byte
+	started    int
+	maxBusy    int
+	busy       int
+}
+
+func newFakeClient() *fakeClient {
+	return &fakeClient{hold: make(chan struct{}), subscribed: make(map[string]byte)}
+}
+
+// run starts an operation, waits for hold and applies it
+func (f *fakeClient) run(apply func()) mqtt.Token {
+	f.mutex.Lock()
+	f.started++
+	f.busy++
+	f.maxBusy = max(f.maxBusy, f.busy)
+	f.mutex.Unlock()
+	return runV5Token(func() error {
+		<-f.hold
+		f.mutex.Lock()
+		defer f.mutex.Unlock()
+		apply()
+		f.busy--
+		return nil
+	})
+}
+
+// operations returns how many subscribes and unsubscribes were started
+func (f *fakeClient) operations() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.started
+}
+
+func (f *fakeClient) IsConnected() bool      { return true }
+func (f *fakeClient) IsConnectionOpen() bool { return true }
+func (f *fakeClient) Connect() mqtt.Token    { return failedV5Token(nil) }
+func (f *fakeClient) Disconnect(uint)        {}
+
+func (f *fakeClient) Publish(string, byte, bool, interface{}) mqtt.Token {
+	return failedV5Token(errors.New("publishing isn't faked"))
+}
+
+func (f *fakeClient) Subscribe(topic string, qos byte, _ mqtt.MessageHandler) mqtt.Token {
+	return f.run(func() { f.subscribed[topic] = qos })
+}
+
+func (f *fakeClient) SubscribeMultiple(filters map[string]byte, _ mqtt.MessageHandler) mqtt.Token {
+	return f.run(func() {
+		for topic, qos := range filters {
+			f.subscribed[topic] = qos
+		}
+	})
+}
+
+func (f *fakeClient) Unsubscribe(topics ...string) mqtt.Token {
+	return f.run(func() {
+		for _, topic := range topics {
+			delete(f.subscribed, topic)
+		}
+	})
+}
+
+func (f *fakeClient) AddRoute(string, mqtt.MessageHandler) {}
+
+func (f *fakeClient) OptionsReader() mqtt.ClientOptionsReader {
+	return mqtt.NewOptionsReader(mqtt.NewClientOptions())
+}
+
+// newFakeMQTTClient returns an MQTTClient talking to a fake client
+func newFakeMQTTClient(t *testing.T) (*MQTTClient, *fakeClient) {
+	t.Helper()
+	client, err := NewMQTTClient(Config{BrokerURL: "tcp://localhost:1883", ClientID: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := newFakeClient()
+	client.client = fake
+	return client, fake
+}
+
+// waitFor polls cond until it holds, failing the test after a second
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSetSubscribedConvergesToLastRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		toggles int
+		final   bool
+	}{
+		{"even toggles end subscribed", 100, true},
+		{"odd toggles end unsubscribed", 101, false},
+		{"single unsubscribe", 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, fake := newFakeMQTTClient(t)
+			done := make(chan error)
+			go func() { done <- client.SetSubscribed("home/temp", true, 1) }()
+			waitFor(t, func() bool { return fake.operations() == 1 })
+
+			// While the first subscribe is in flight every toggle only
+			// records the wanted state and returns
+			subscribed := true
+			for range tt.toggles {
+				subscribed = !subscribed
+				if err := client.SetSubscribed("home/temp", subscribed, 1); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if subscribed != tt.final {
+				t.Fatalf("test toggles end at %t, want %t", subscribed, tt.final)
+			}
+			close(fake.hold)
+			if err := <-done; err != nil {
+				t.Fatal(err)
+			}
+
+			_, brokerHas := fake.subscribed["home/temp"]
+			if brokerHas != tt.final || client.isSubscribed["home/temp"] != tt.final {
+				t.Errorf("broker subscribed %t, client subscribed %t, want %t", brokerHas, client.isSubscribed["home/temp"], tt.final)
+			}
+			// The first subscribe plus at most one more to settle
+			if ops := fake.operations(); ops > 2 {
+				t.Errorf("%d operations sent, want at most 2", ops)
+			}
+			if fake.maxBusy > 1 {
+				t.Errorf("%d operations on the topic at once, want 1", fake.maxBusy)
+			}
+		})
+	}
+}
+
+func TestDuplicateMessages(t *testing.T) {
+	tests := []struct {
+		name        string
+		filters     []string
+		discovering bool
+		qos         byte
+		ids         []uint16
+		gap         time.Duration
+		want        int
+	}{
+		{"one subscription keeps repeats", []string{"home/button"}, false, 0, []uint16{0, 0}, 10 * time.Millisecond, 2},
+		{"one subscription keeps back to back repeats", []string{"home/button"}, false, 0, []uint16{0, 0}, 0, 2},
+		{"overlapping filters drop the copy", []string{"home/button", "home/#"}, false, 0, []uint16{0, 0}, 0, 1},
+		{"discovery and a subscription drop the copy", []string{"home/button"}, true, 0, []uint16{0, 0}, 0, 1},
+		{"overlapping QoS 1 with different ids kept", []string{"home/button", "home/#"}, false, 1, []uint16{1, 2}, 0, 2},
+		{"overlapping QoS 1 with the same id dropped", []string{"home/button", "home/#"}, false, 1, []uint16{7, 7}, 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, fake := newFakeMQTTClient(t)
+			var received []Message
+			client.SetMessageSink(func(msg Message) { received = append(received, msg) })
+			for _, filter := range tt.filters {
+				client.wantSubscribed[filter] = true
+				client.isSubscribed[filter] = true
+			}
+			client.discovering.Store(tt.discovering)
+
+			for _, id := range tt.ids {
+				client.publishHandler(fake, &v5Message{publish: &paho.Publish{
+					Topic:    "home/button",
+					Payload:  []byte("pressed"),
+					QoS:      tt.qos,
+					PacketID: id,
+				}})
+				time.Sleep(tt.gap)
+			}
+			if len(received) != tt.want {
+				t.Errorf("%d messages delivered, want %d", len(received), tt.want)
+			}
+		})
+	}
+}
+
+func TestSetSubscribedConcurrentToggles(t *testing.T) {
+	client, fake := newFakeMQTTClient(t)
+	done := make(chan error)
+	go func() { done <- client.SetSubscribed("home/temp", true, 0) }()
+	waitFor(t, func() bool { return fake.operations() == 1 })
+
+	var wg sync.WaitGroup
+	for i := range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client.SetSubscribed("home/temp", i%2 == 0, 0)
+		}()
+	}
+	wg.Wait()
+	// The last request decides, whatever order the spam arrived in
+	client.SetSubscribed("home/temp", false, 0)
+	close(fake.hold)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := fake.subscribed["home/temp"]; ok || client.isSubscribed["home/temp"] {
+		t.Error("still subscribed after the last request unsubscribed")
+	}
+	if fake.maxBusy > 1 {
+		t.Errorf("%d operations on the topic at once, want 1", fake.maxBusy)
+	}
+}
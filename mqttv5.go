@@ -0,0 +1,641 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eclipse/paho.golang/packets"
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/eclipse/paho.golang/paho/session/state"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// MessageProperties holds the MQTT 5 properties a message was published with
+type MessageProperties struct {
+	ContentType     string
+	ResponseTopic   string
+	CorrelationData []byte
+	User            []UserProperty
+}
+
+// UserProperty is one of a message's user properties; keys may repeat
+type UserProperty struct {
+	Key   string
+	Value string
+}
+
+// messageWithProperties is a received message carrying MQTT 5 properties
+type messageWithProperties interface {
+	Properties() *MessageProperties
+}
+
+// subscribeResult is a subscribe token reporting the QoS granted, or the
+// failure reason code, per topic filter
+type subscribeResult interface {
+	Result() map[string]byte
+}
+
+// reasonCodeNames describes the MQTT 5 reason codes a broker may send when
+// refusing a connection or subscription, or when disconnecting
+var reasonCodeNames = map[byte]string{
+	0x00: "normal disconnection",
+	0x04: "disconnect with will message",
+	0x80: "unspecified error",
+	0x81: "malformed packet",
+	0x82: "protocol error",
+	0x83: "implementation specific error",
+	0x84: "unsupported protocol version",
+	0x85: "client identifier not valid",
+	0x86: "bad user name or password",
+	0x87: "not authorized",
+	0x88: "server unavailable",
+	0x89: "server busy",
+	0x8A: "banned",
+	0x8B: "server shutting down",
+	0x8C: "bad authentication method",
+	0x8D: "keep alive timeout",
+	0x8E: "session taken over",
+	0x8F: "topic filter invalid",
+	0x90: "topic name invalid",
+	0x93: "receive maximum exceeded",
+	0x94: "topic alias invalid",
+	0x95: "packet too large",
+	0x96: "message rate too high",
+	0x97: "quota exceeded",
+	0x98: "administrative action",
+	0x99: "payload format invalid",
+	0x9A: "retain not supported",
+	0x9B: "QoS not supported",
+	0x9C: "use another server",
+	0x9D: "server moved",
+	0x9E: "shared subscriptions not supported",
+	0x9F: "connection rate exceeded",
+	0xA0: "maximum connect time",
+	0xA1: "subscription identifiers not supported",
+	0xA2: "wildcard subscriptions not supported",
+}
+
+// reasonCodeName describes an MQTT 5 reason code, with the code itself
+func reasonCodeName(code byte) string {
+	if name, ok := reasonCodeNames[code]; ok {
+		return fmt.Sprintf("%s (0x%02X)", name, code)
+	}
+	return fmt.Sprintf("reason code 0x%02X", code)
+}
+
+// DisconnectError is the reason an MQTT 5 broker gave in its DISCONNECT
+type DisconnectError struct {
+	Code byte
+	// Reason is the broker's own explanation, often empty
+	Reason string
+}
+
+func (e *DisconnectError) Error() string {
+	msg := "broker disconnected: " + reasonCodeName(e.Code)
+	if e.Reason != "" && !strings.EqualFold(e.Reason, reasonCodeNames[e.Code]) {
+		msg += ", " + e.Reason
+	}
+	return msg
+}
+
+// errV5Unsupported is returned when a broker refuses MQTT 5 itself rather
+// than the connection; the client falls back to 3.1.1 then
+var errV5Unsupported = errors.New("broker doesn't support MQTT 5")
+
+// unsupportedProtocolVersion is the MQTT 5 CONNACK reason code for a protocol
+// version the broker doesn't speak
+const unsupportedProtocolVersion = 0x84
+
+// v5Unsupported reports whether a refused MQTT 5 connection was refused for
+// the protocol version: an MQTT 5 CONNACK saying so, or a 3.1.x broker's
+// CONNACK with return code 1, which paho.golang can't parse and which only
+// shows in the first bytes read
+func v5Unsupported(connack *paho.Connack, head []byte) bool {
+	if connack != nil {
+		return connack.ReasonCode == unsupportedProtocolVersion
+	}
+	return len(head) >= 4 && head[0] == packets.CONNACK<<4 && head[1] == 2 && head[3] == 1
+}
+
+// headRecorder keeps the first bytes read from a connection, to tell why a
+// CONNACK couldn't be parsed
+type headRecorder struct {
+	net.Conn
+	mutex sync.Mutex
+	buf   []byte
+}
+
+func (r *headRecorder) Read(p []byte) (int, error) {
+	n, err := r.Conn.Read(p)
+	r.mutex.Lock()
+	if missing := 4 - len(r.buf); missing > 0 {
+		r.buf = append(r.buf, p[:min(n, missing)]...)
+	}
+	r.mutex.Unlock()
+	return n, err
+}
+
+// head returns the bytes recorded so far
+func (r *headRecorder) head() []byte {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return slices.Clone(r.buf)
+}
+
+// v5Client speaks MQTT 5 through paho.golang behind the mqtt.Client
+// interface of the 3.1.1 client. It takes its settings and handlers from the
+// same options, so MQTTClient drives both protocol versions alike. Every
+// connection is a new paho.golang client sharing one session state.
+type v5Client struct {
+	opts    *mqtt.ClientOptions
+	session *state.State
+
+	// stop is closed by Disconnect, ending reconnection
+	stop     chan struct{}
+	stopOnce sync.Once
+
+	mutex  sync.Mutex
+	conn   *paho.Client // nil while not connected
+	routes []v5Route
+}
+
+// v5Route hands messages matching a subscription's filter to its handler
+type v5Route struct {
+	filter  string
+	handler mqtt.MessageHandler
+}
+
+// newV5Client creates an MQTT 5 client from 3.1.1 client options
+func newV5Client(opts *mqtt.ClientOptions) *v5Client {
+	return &v5Client{
+		opts:    opts,
+		session: state.NewInMemory(),
+		stop:    make(chan struct{}),
+	}
+}
+
+func (c *v5Client) IsConnected() bool {
+	return c.connection() != nil
+}
+
+func (c *v5Client) IsConnectionOpen() bool {
+	return c.connection() != nil
+}
+
+// connection returns the current connection, nil while disconnected
+func (c *v5Client) connection() *paho.Client {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.conn
+}
+
+// stopped reports whether Disconnect was called
+func (c *v5Client) stopped() bool {
+	select {
+	case <-c.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *v5Client) Connect() mqtt.Token {
+	return runV5Token(c.connectAny)
+}
+
+// connectAny tries each broker in turn, like the 3.1.1 client, returning the
+// last broker's error when none accepts the connection
+func (c *v5Client) connectAny() error {
+	err := errors.New("no broker to connect to")
+	for _, broker := range c.opts.Servers {
+		if err = c.connectTo(broker); err == nil {
+			return nil
+		}
+		logDebug("MQTT 5 connection to %s failed: %v", broker, err)
+	}
+	return err
+}
+
+// connectTo connects to one broker and starts watching the connection
+func (c *v5Client) connectTo(broker *url.URL) error {
+	tlsConfig := c.opts.TLSConfig
+	if c.opts.OnConnectAttempt != nil {
+		tlsConfig = c.opts.OnConnectAttempt(broker, tlsConfig)
+	}
+	ctx := context.Background()
+	if c.opts.ConnectTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.opts.ConnectTimeout)
+		defer cancel()
+	}
+	dialed, err := dialV5Broker(ctx, broker, tlsConfig)
+	if err != nil {
+		return err
+	}
+	conn := &headRecorder{Conn: dialed}
+
+	// paho.golang reports why a connection ended just after closing it
+	lost := make(chan error, 1)
+	report := func(err error) {
+		select {
+		case lost <- err:
+		default:
+		}
+	}
+	client := paho.NewClient(paho.ClientConfig{
+		ClientID:          c.opts.ClientID,
+		Conn:              conn,
+		Session:           c.session,
+		OnPublishReceived: []func(paho.PublishReceived) (bool, error){c.route},
+		OnServerDisconnect: func(d *paho.Disconnect) {
+			disconnect := &DisconnectError{Code: d.ReasonCode}
+			if d.Properties != nil {
+				disconnect.Reason = d.Properties.ReasonString
+			}
+			report(disconnect)
+		},
+		OnClientError: report,
+	})
+
+	connect := &paho.Connect{
+		ClientID:     c.opts.ClientID,
+		KeepAlive:    uint16(min(c.opts.KeepAlive, math.MaxUint16)),
+		CleanStart:   c.opts.CleanSession,
+		Username:     c.opts.Username,
+		UsernameFlag: c.opts.Username != "",
+		Password:     []byte(c.opts.Password),
+		PasswordFlag: c.opts.Password != "",
+	}
+	// Without an expiry an MQTT 5 session ends with the connection
+	if !c.opts.CleanSession {
+		connect.Properties = &paho.ConnectProperties{SessionExpiryInterval: paho.Uint32(math.MaxUint32)}
+	}
+	connack, err := client.Connect(ctx, connect)
+	if err != nil {
+		if v5Unsupported(connack, conn.head()) {
+			return fmt.Errorf("broker refused the connection: %w", errV5Unsupported)
+		}
+		if connack != nil && connack.ReasonCode >= subackFailure {
+			err = fmt.Errorf("broker refused the connection: %s", reasonCodeName(connack.ReasonCode))
+		}
+		return err
+	}
+
+	c.mutex.Lock()
+	if c.stopped() {
+		c.mutex.Unlock()
+		client.Disconnect(&paho.Disconnect{ReasonCode: packets.DisconnectNormalDisconnection})
+		return errors.New("client disconnected")
+	}
+	c.conn = client
+	c.mutex.Unlock()
+
+	go c.watch(client, lost)
+	if c.opts.OnConnect != nil {
+		go c.opts.OnConnect(c)
+	}
+	return nil
+}
+
+// dialV5Broker opens the network connection to a broker. The websocket
+// transports of the 3.1.1 client aren't available for MQTT 5.
+func dialV5Broker(ctx context.Context, broker *url.URL, tlsConfig *tls.Config) (net.Conn, error) {
+	scheme := strings.ToLower(broker.Scheme)
+	switch {
+	case scheme == "tcp" || scheme == "mqtt":
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, "tcp", brokerHostPort(broker, "1883"))
+	case tlsSchemes[scheme] && scheme != "wss":
+		dialer := tls.Dialer{Config: tlsConfig}
+		conn, err := dialer.DialContext(ctx, "tcp", brokerHostPort(broker, "8883"))
+		if err != nil {
+			return nil, err
+		}
+		// paho.golang writes from several goroutines, which tls.Conn doesn't allow
+		return packets.NewThreadSafeConn(conn), nil
+	}
+	return nil, fmt.Errorf("%s:// brokers aren't supported with MQTT 5, use tcp:// or ssl://", broker.Scheme)
+}
+
+// brokerHostPort returns a broker URL's host and port, defaulting the port
+func brokerHostPort(broker *url.URL, defaultPort string) string {
+	if broker.Port() != "" {
+		return broker.Host
+	}
+	return net.JoinHostPort(broker.Hostname(), defaultPort)
+}
+
+// watch waits for a connection to end and, unless Disconnect ended it,
+// reports why and reconnects
+func (c *v5Client) watch(client *paho.Client, lost <-chan error) {
+	<-client.Done()
+	c.mutex.Lock()
+	if c.conn == client {
+		c.conn = nil
+	}
+	c.mutex.Unlock()
+
+	var err error
+	select {
+	case <-c.stop:
+		return
+	case err = <-lost:
+	case <-time.After(time.Second):
+	}
+	if c.opts.OnConnectionLost != nil {
+		c.opts.OnConnectionLost(c, err)
+	}
+	if c.opts.AutoReconnect {
+		c.reconnect()
+	}
+}
+
+// reconnect retries the brokers until one accepts, doubling the delay
+// between attempts up to the maximum reconnect interval
+func (c *v5Client) reconnect() {
+	delay := time.Second
+	for !c.stopped() {
+		if c.opts.OnReconnecting != nil {
+			c.opts.OnReconnecting(c, c.opts)
+		}
+		err := c.connectAny()
+		if err == nil {
+			return
+		}
+		logDebug("MQTT 5 reconnect failed: %v", err)
+		select {
+		case <-c.stop:
+			return
+		case <-time.After(delay):
+		}
+		delay *= 2
+		if c.opts.MaxReconnectInterval > 0 {
+			delay = min(delay, c.opts.MaxReconnectInterval)
+		}
+	}
+}
+
+// Disconnect closes the connection and stops reconnecting. The caller
+// already waits for in-flight publishes, so there is nothing to quiesce.
+func (c *v5Client) Disconnect(quiesce uint) {
+	c.stopOnce.Do(func() { close(c.stop) })
+	c.mutex.Lock()
+	client := c.conn
+	c.conn = nil
+	c.mutex.Unlock()
+	if client != nil {
+		client.Disconnect(&paho.Disconnect{ReasonCode: packets.DisconnectNormalDisconnection})
+	}
+}
+
+func (c *v5Client) Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
+	var data []byte
+	switch p := payload.(type) {
+	case string:
+		data = []byte(p)
+	case []byte:
+		data = p
+	default:
+		return failedV5Token(fmt.Errorf("unknown payload type %T", payload))
+	}
+	client := c.connection()
+	if client == nil {
+		return failedV5Token(errors.New("not connected"))
+	}
+	return runV5Token(func() error {
+		_, err := client.Publish(context.Background(), &paho.Publish{
+			Topic:   topic,
+			QoS:     qos,
+			Retain:  retained,
+			Payload: data,
+		})
+		return err
+	})
+}
+
+func (c *v5Client) Subscribe(topic string, qos byte, callback mqtt.MessageHandler) mqtt.Token {
+	return c.SubscribeMultiple(map[string]byte{topic: qos}, callback)
+}
+
+func (c *v5Client) SubscribeMultiple(filters map[string]byte, callback mqtt.MessageHandler) mqtt.Token {
+	token := &v5SubscribeToken{v5Token: newV5Token(), result: make(map[string]byte)}
+	client := c.connection()
+	if client == nil {
+		token.finish(errors.New("not connected"))
+		return token
+	}
+
+	topics := make([]string, 0, len(filters))
+	for topic := range filters {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	subscribe := &paho.Subscribe{}
+	for _, topic := range topics {
+		subscribe.Subscriptions = append(subscribe.Subscriptions, paho.SubscribeOptions{Topic: topic, QoS: filters[topic]})
+		if callback != nil {
+			c.AddRoute(topic, callback)
+		}
+	}
+
+	go func() {
+		suback, err := client.Subscribe(context.Background(), subscribe)
+		if suback == nil {
+			token.finish(err)
+			return
+		}
+		// paho.golang's error for a refused filter leaves out the reason
+		err = nil
+		for i, code := range suback.Reasons {
+			if i >= len(topics) {
+				break
+			}
+			token.result[topics[i]] = code
+			if code >= subackFailure && err == nil {
+				err = fmt.Errorf("subscription to %s rejected by broker: %s", topics[i], reasonCodeName(code))
+			}
+		}
+		token.finish(err)
+	}()
+	return token
+}
+
+func (c *v5Client) Unsubscribe(topics ...string) mqtt.Token {
+	c.mutex.Lock()
+	c.routes = slices.DeleteFunc(c.routes, func(r v5Route) bool {
+		return slices.Contains(topics, r.filter)
+	})
+	c.mutex.Unlock()
+
+	client := c.connection()
+	if client == nil {
+		return failedV5Token(errors.New("not connected"))
+	}
+	return runV5Token(func() error {
+		_, err := client.Unsubscribe(context.Background(), &paho.Unsubscribe{Topics: topics})
+		return err
+	})
+}
+
+// AddRoute sets the handler for messages matching a filter, replacing any
+// handler the filter had
+func (c *v5Client) AddRoute(topic string, callback mqtt.MessageHandler) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for i := range c.routes {
+		if c.routes[i].filter == topic {
+			c.routes[i].handler = callback
+			return
+		}
+	}
+	c.routes = append(c.routes, v5Route{filter: topic, handler: callback})
+}
+
+func (c *v5Client) OptionsReader() mqtt.ClientOptionsReader {
+	return mqtt.NewOptionsReader(c.opts)
+}
+
+// route hands a received message to the handler of every subscription it
+// matches, in subscription order, or to the default handler if none does
+func (c *v5Client) route(received paho.PublishReceived) (bool, error) {
+	msg := &v5Message{publish: received.Packet}
+	var handlers []mqtt.MessageHandler
+	c.mutex.Lock()
+	for _, r := range c.routes {
+		if topicMatches(sharedFilter(r.filter), msg.Topic()) {
+			handlers = append(handlers, r.handler)
+		}
+	}
+	c.mutex.Unlock()
+	if len(handlers) == 0 && c.opts.DefaultPublishHandler != nil {
+		handlers = append(handlers, c.opts.DefaultPublishHandler)
+	}
+	for _, handler := range handlers {
+		handler(c, msg)
+	}
+	return true, nil
+}
+
+// sharedFilter strips the $share/<group>/ prefix of a shared subscription,
+// leaving the filter that topics are matched against
+func sharedFilter(filter string) string {
+	if rest, ok := strings.CutPrefix(filter, "$share/"); ok {
+		if _, filter, ok := strings.Cut(rest, "/"); ok {
+			return filter
+		}
+	}
+	return filter
+}
+
+// v5Message is a received MQTT 5 message as an mqtt.Message
+type v5Message struct {
+	publish *paho.Publish
+}
+
+func (m *v5Message) Duplicate() bool   { return m.publish.Duplicate() }
+func (m *v5Message) Qos() byte         { return m.publish.QoS }
+func (m *v5Message) Retained() bool    { return m.publish.Retain }
+func (m *v5Message) Topic() string     { return m.publish.Topic }
+func (m *v5Message) MessageID() uint16 { return m.publish.PacketID }
+func (m *v5Message) Payload() []byte   { return m.publish.Payload }
+
+// Ack does nothing: paho.golang acknowledges once the handlers return
+func (m *v5Message) Ack() {}
+
+// Properties returns the message's properties, nil when it has none worth
+// showing
+func (m *v5Message) Properties() *MessageProperties {
+	p := m.publish.Properties
+	if p == nil || (p.ContentType == "" && p.ResponseTopic == "" && len(p.CorrelationData) == 0 && len(p.User) == 0) {
+		return nil
+	}
+	props := &MessageProperties{
+		ContentType:     p.ContentType,
+		ResponseTopic:   p.ResponseTopic,
+		CorrelationData: p.CorrelationData,
+	}
+	for _, user := range p.User {
+		props.User = append(props.User, UserProperty{Key: user.Key, Value: user.Value})
+	}
+	return props
+}
+
+// v5Token completes when an MQTT 5 operation has finished
+type v5Token struct {
+	done chan struct{}
+	err  error
+}
+
+func newV5Token() *v5Token {
+	return &v5Token{done: make(chan struct{})}
+}
+
+// runV5Token runs an operation in the background, completing the token
+// with its result
+func runV5Token(run func() error) *v5Token {
+	token := newV5Token()
+	go func() { token.finish(run()) }()
+	return token
+}
+
+// failedV5Token returns a token that has already failed with err
+func failedV5Token(err error) *v5Token {
+	token := newV5Token()
+	token.finish(err)
+	return token
+}
+
+func (t *v5Token) finish(err error) {
+	t.err = err
+	close(t.done)
+}
+
+func (t *v5Token) Wait() bool {
+	<-t.done
+	return true
+}
+
+func (t *v5Token) WaitTimeout(timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-t.done:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+func (t *v5Token) Done() <-chan struct{} {
+	return t.done
+}
+
+func (t *v5Token) Error() error {
+	select {
+	case <-t.done:
+		return t.err
+	default:
+		return nil
+	}
+}
+
+// v5SubscribeToken is a subscribe token with the SUBACK reason codes
+type v5SubscribeToken struct {
+	*v5Token
+	result map[string]byte
+}
+
+// Result returns the QoS granted, or the failure reason code, per filter
+func (t *v5SubscribeToken) Result() map[string]byte {
+	return t.result
+}
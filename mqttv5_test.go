@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.golang/paho"
+)
+
+func TestV5Unsupported(t *testing.T) {
+	tests := []struct {
+		name    string
+		connack *paho.Connack
+		head    []byte
+		want    bool
+	}{
+		{"MQTT 5 unsupported protocol version", &paho.Connack{ReasonCode: 0x84}, nil, true},
+		{"MQTT 5 bad credentials", &paho.Connack{ReasonCode: 0x86}, nil, false},
+		{"MQTT 5 not authorized", &paho.Connack{ReasonCode: 0x87}, nil, false},
+		{"3.1.1 unacceptable protocol version", nil, []byte{0x20, 0x02, 0x00, 0x01}, true},
+		{"3.1.1 bad credentials", nil, []byte{0x20, 0x02, 0x00, 0x04}, false},
+		{"3.1.1 not authorized", nil, []byte{0x20, 0x02, 0x00, 0x05}, false},
+		{"connection closed without a CONNACK", nil, nil, false},
+		{"not a CONNACK", nil, []byte{0x30, 0x02, 0x00, 0x01}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := v5Unsupported(tt.connack, tt.head); got != tt.want {
+				t.Errorf("v5Unsupported = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+// serveV311 runs a broker that only speaks 3.1.x: MQTT 5 connections are
+// refused with return code 1, later ones accepted and held open
+func serveV311(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mutex sync.Mutex
+	var conns []net.Conn
+	t.Cleanup(func() {
+		listener.Close()
+		mutex.Lock()
+		defer mutex.Unlock()
+		for _, conn := range conns {
+			conn.Close()
+		}
+	})
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			mutex.Lock()
+			conns = append(conns, conn)
+			mutex.Unlock()
+			// Fixed header, remaining length, "\x00\x04MQTT", protocol level
+			connect := make([]byte, 9)
+			if _, err := conn.Read(connect); err != nil {
+				conn.Close()
+				continue
+			}
+			if connect[8] == 5 {
+				conn.Write([]byte{0x20, 0x02, 0x00, 0x01})
+				conn.Close()
+				continue
+			}
+			conn.Write([]byte{0x20, 0x02, 0x00, 0x00})
+		}
+	}()
+	return "tcp://" + listener.Addr().String()
+}
+
+func TestV5RefusedByV311Broker(t *testing.T) {
+	broker := serveV311(t)
+	client, err := NewMQTTClient(Config{BrokerURL: broker, ClientID: "test", ProtocolVersion: 5, ConnectTimeout: time.Second, KeepAlive: 30 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v5, ok := client.client.(*v5Client)
+	if !ok {
+		t.Fatalf("client is a %T, want an MQTT 5 client", client.client)
+	}
+	u, err := url.Parse(broker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v5.connectTo(u); !errors.Is(err, errV5Unsupported) {
+		t.Fatalf("connectTo = %v, want %v", err, errV5Unsupported)
+	}
+
+	if err := client.connect(); err != nil {
+		t.Fatalf("connect after falling back = %v", err)
+	}
+	defer client.client.Disconnect(0)
+	if _, ok := client.client.(*v5Client); ok || client.config.ProtocolVersion != 4 {
+		t.Errorf("still MQTT 5 after the broker refused it: %T, protocol version %d", client.client, client.config.ProtocolVersion)
+	}
+	if !client.IsConnected() {
+		t.Error("not connected after falling back to 3.1.1")
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxHexDumpLines caps the hex dump shown for a single message in the
+// messages pane
+const maxHexDumpLines = 16
+
+// payloadBytes returns a message's payload bytes exactly as received
+func payloadBytes(msg Message) []byte {
+	if msg.Raw != nil {
+		return msg.Raw
+	}
+	return []byte(msg.Payload)
+}
+
+// sanitizePayload makes a payload safe to print: NULs and other control
+// characters, which terminals swallow or act on, are shown as their Unicode
+// control pictures (␀, ␛, …) and invalid UTF-8 as �. Newlines and tabs are kept.
+func sanitizePayload(payload string) string {
+	clean := true
+	for i := 0; i < len(payload); i++ {
+		if c := payload[i]; (c < 0x20 && c != '\n' && c != '\t') || c >= 0x7f {
+			clean = false
+			break
+		}
+	}
+	if clean {
+		return payload
+	}
+
+	var b strings.Builder
+	b.Grow(len(payload))
+	for i := 0; i < len(payload); {
+		r, size := utf8.DecodeRuneInString(payload[i:])
+		i += size
+		switch {
+		case r == '\n' || r == '\t':
+			b.WriteRune(r)
+		case r < 0x20:
+			b.WriteRune(0x2400 + r)
+		case r == 0x7f:
+			b.WriteRune('␡')
+		case r >= 0x80 && r < 0xa0:
+			// C1 controls have no pictures of their own
+			b.WriteRune('�')
+		default:
+			// utf8.RuneError for invalid bytes prints as �
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// hexDump renders bytes hexdump-style: offset, 16 hex bytes and their
+// printable ASCII, returning at most maxLines lines (0 for all)
+func hexDump(data []byte, maxLines int) []string {
+	var lines []string
+	for offset := 0; offset < len(data); offset += 16 {
+		if maxLines > 0 && len(lines) == maxLines {
+			lines = append(lines, fmt.Sprintf("… %d more bytes", len(data)-offset))
+			break
+		}
+		end := min(offset+16, len(data))
+		chunk := data[offset:end]
+
+		var hex, ascii strings.Builder
+		for i := 0; i < 16; i++ {
+			if i == 8 {
+				hex.WriteByte(' ')
+			}
+			if i < len(chunk) {
+				fmt.Fprintf(&hex, "%02x ", chunk[i])
+			} else {
+				hex.WriteString("   ")
+			}
+		}
+		for _, c := range chunk {
+			if c >= 0x20 && c < 0x7f {
+				ascii.WriteByte(c)
+			} else {
+				ascii.WriteByte('.')
+			}
+		}
+		lines = append(lines, fmt.Sprintf("%08x  %s |%s|", offset, hex.String(), ascii.String()))
+	}
+	return lines
+}
+
+// hexBytes renders the leading bytes of data as space-separated hex on one line
+func hexBytes(data []byte, width int) string {
+	n := min(len(data), (width+1)/3)
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		fmt.Fprintf(&b, "%02x", data[i])
+	}
+	return b.String()
+}
+
+// PayloadDecoder is how payloads are interpreted for display
+type PayloadDecoder int
+
+const (
+	TextDecoder PayloadDecoder = iota
+	HexDecoder
+	Base64Decoder
+)
+
+// decoderNames are the decoders' names, in cycling order
+var decoderNames = []string{"text", "hex", "base64"}
+
+func (d PayloadDecoder) String() string {
+	return decoderNames[d]
+}
+
+// next returns the decoder after d, wrapping around
+func (d PayloadDecoder) next() PayloadDecoder {
+	return (d + 1) % PayloadDecoder(len(decoderNames))
+}
+
+// base64Encodings are tried in turn, since publishers disagree on the
+// alphabet and padding
+var base64Encodings = []*base64.Encoding{
+	base64.StdEncoding,
+	base64.RawStdEncoding,
+	base64.URLEncoding,
+	base64.RawURLEncoding,
+}
+
+// decodeBase64 decodes a base64 payload in any of the common alphabets,
+// ignoring surrounding whitespace
+func decodeBase64(payload []byte) ([]byte, error) {
+	text := strings.TrimSpace(string(payload))
+	if text == "" {
+		return nil, errors.New("empty payload")
+	}
+	var err error
+	for _, enc := range base64Encodings {
+		var decoded []byte
+		if decoded, err = enc.DecodeString(text); err == nil {
+			return decoded, nil
+		}
+	}
+	return nil, err
+}
+
+// isText reports whether data reads as text: valid UTF-8 without control
+// characters other than whitespace
+func isText(data []byte) bool {
+	if !utf8.Valid(data) {
+		return false
+	}
+	for _, c := range data {
+		if c < 0x20 && c != '\n' && c != '\r' && c != '\t' {
+			return false
+		}
+	}
+	return true
+}
+
+// decodedPayload applies the payload decoder, returning the bytes to show
+// and whether they are binary, which is shown as a hex dump. A payload the
+// decoder can't handle is shown raw with a note saying why.
+func (ui *UI) decodedPayload(msg Message) (data []byte, binary bool, note string) {
+	switch ui.decoder {
+	case HexDecoder:
+		return payloadBytes(msg), true, ""
+	case Base64Decoder:
+		decoded, err := decodeBase64(payloadBytes(msg))
+		if err != nil {
+			return payloadBytes(msg), false, "not base64, shown raw"
+		}
+		return decoded, !isText(decoded), ""
+	}
+	data = []byte(displayPayload(msg))
+	if ui.pipeline != nil {
+		decoded, err := ui.applyPipeline(msg, data)
+		if err != nil {
+			note = fmt.Sprintf("decode failed at %v", err)
+		}
+		return decoded, !isText(decoded), note
+	}
+	return data, false, ""
+}
+
+// previewPayload cuts a message's payload to the messages pane's byte limit,
+// so a huge retained payload can't stall rendering, and returns the note to
+// show below it. The inspector and exports use the full message.
+func (ui *UI) previewPayload(msg Message) (Message, string) {
+	size := len(payloadBytes(msg))
+	limit := ui.maxPayloadBytes
+	if limit <= 0 || size <= limit {
+		return msg, ""
+	}
+	msg.Raw = payloadBytes(msg)[:limit]
+	msg.Payload = msg.Payload[:min(len(msg.Payload), limit)]
+	msg.Decoded = msg.Decoded[:min(len(msg.Decoded), limit)]
+	return msg, fmt.Sprintf("… (truncated, %s)", formatBytes(size))
+}
+
+// previewDecoded decodes a message for the messages pane, cut to its byte
+// limit, and returns the truncation note. The base64 decoder and the decode
+// pipeline need the whole payload, as gunzip or base64 fail on a cut one, so
+// their output is cut instead; otherwise only the part shown is decoded.
+func (ui *UI) previewDecoded(msg Message) (data []byte, binary bool, note, truncated string) {
+	if ui.decoder == Base64Decoder || (ui.decoder == TextDecoder && ui.pipeline != nil) {
+		data, binary, note = ui.decodedPayload(msg)
+		if limit := ui.maxPayloadBytes; limit > 0 && len(data) > limit {
+			truncated = fmt.Sprintf("… (truncated, %s)", formatBytes(len(data)))
+			data = data[:limit]
+		}
+		return data, binary, note, truncated
+	}
+	preview, truncated := ui.previewPayload(msg)
+	data, binary, note = ui.decodedPayload(preview)
+	return data, binary, note, truncated
+}
+
+// imagePlaceholder describes a PNG, JPEG or GIF payload in place of its bytes
+// while payloads are shown as text; the hex and base64 decoders still show
+// the bytes
+func (ui *UI) imagePlaceholder(msg Message) (string, bool) {
+	if ui.decoder != TextDecoder || msg.Decoded != "" {
+		return "", false
+	}
+	return imageSummary(payloadBytes(msg))
+}
+
+// imageSummary recognizes an image by its magic bytes and describes it as
+// e.g. "[image/png, 12.4 KB, 640x480]"; the size is left out when the header
+// can't be parsed
+func imageSummary(data []byte) (string, bool) {
+	var mime string
+	switch {
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		mime = "image/png"
+	case bytes.HasPrefix(data, []byte{0xff, 0xd8, 0xff}):
+		mime = "image/jpeg"
+	case bytes.HasPrefix(data, []byte("GIF87a")), bytes.HasPrefix(data, []byte("GIF89a")):
+		mime = "image/gif"
+	default:
+		return "", false
+	}
+	summary := fmt.Sprintf("[%s, %s", mime, formatBytes(len(data)))
+	if config, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+		summary += fmt.Sprintf(", %dx%d", config.Width, config.Height)
+	}
+	return summary + "]", true
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSanitizePayload(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    string
+	}{
+		{"plain text", "temp=21.5", "temp=21.5"},
+		{"embedded NUL", "ab\x00cd", "ab␀cd"},
+		{"only NULs", "\x00\x00", "␀␀"},
+		{"trailing NUL", "id\x00", "id␀"},
+		{"escape and bell", "\x1b[2J\a", "␛[2J␇"},
+		{"newlines and tabs kept", "a\n\tb\x00", "a\n\tb␀"},
+		{"carriage return shown", "a\rb", "a␍b"},
+		{"delete", "a\x7fb", "a␡b"},
+		{"invalid UTF-8 next to NUL", "\xff\x00", "�␀"},
+		{"C1 control", "a\u0085b", "a�b"},
+		{"multibyte text kept", "température\x00", "température␀"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sanitizePayload(tt.payload); got != tt.want {
+				t.Errorf("sanitizePayload(%q) = %q, want %q", tt.payload, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHexDump(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		maxLines int
+		want     []string
+	}{
+		{
+			name: "NULs between text",
+			data: []byte("ab\x00\x00cd"),
+			want: []string{
+				"00000000  61 62 00 00 63 64                                 |ab..cd|",
+			},
+		},
+		{
+			name: "all NULs over two lines",
+			data: make([]byte, 17),
+			want: []string{
+				"00000000  00 00 00 00 00 00 00 00  00 00 00 00 00 00 00 00  |................|",
+				"00000010  00                                                |.|",
+			},
+		},
+		{
+			name:     "capped with NULs left over",
+			data:     append([]byte("0123456789abcdef"), 0, 0, 0),
+			maxLines: 1,
+			want: []string{
+				"00000000  30 31 32 33 34 35 36 37  38 39 61 62 63 64 65 66  |0123456789abcdef|",
+				"… 3 more bytes",
+			},
+		},
+		{
+			name: "empty",
+			data: nil,
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := hexDump(tt.data, tt.maxLines)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("hexDump(%q, %d) =\n%q\nwant\n%q", tt.data, tt.maxLines, got, tt.want)
+			}
+		})
+	}
+}
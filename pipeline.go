@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// maxGunzipBytes caps a decompressed payload, so a small compressed payload
+// can't expand into gigabytes
+const maxGunzipBytes = 16 << 20
+
+// decodeStep is one stage of a decode pipeline
+type decodeStep func([]byte) ([]byte, error)
+
+// decodeSteps are the pipeline stages by the name used in MQTT_PIPELINE
+var decodeSteps = map[string]decodeStep{
+	"gunzip":      gunzipStep,
+	"base64":      decodeBase64,
+	"json-pretty": jsonPrettyStep,
+}
+
+// DecodePipeline decodes payloads through an ordered list of named steps,
+// e.g. gunzip then json-pretty, before they are shown
+type DecodePipeline struct {
+	names []string
+	steps []decodeStep
+}
+
+// parseDecodePipeline parses a comma-separated list of step names; an empty
+// spec is no pipeline
+func parseDecodePipeline(spec string) (*DecodePipeline, error) {
+	var p DecodePipeline
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		step, ok := decodeSteps[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown step %q, expected one of %s", name, strings.Join(decodeStepNames(), ", "))
+		}
+		p.names = append(p.names, name)
+		p.steps = append(p.steps, step)
+	}
+	if len(p.steps) == 0 {
+		return nil, nil
+	}
+	return &p, nil
+}
+
+// decodeStepNames lists the known step names in order
+func decodeStepNames() []string {
+	names := make([]string, 0, len(decodeSteps))
+	for name := range decodeSteps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// String returns the pipeline as configured, e.g. "gunzip,json-pretty"
+func (p *DecodePipeline) String() string {
+	return strings.Join(p.names, ",")
+}
+
+// Apply runs data through the steps in order. When a step fails it stops
+// there and returns the last good output with the step's error.
+func (p *DecodePipeline) Apply(data []byte) ([]byte, error) {
+	for i, step := range p.steps {
+		out, err := step(data)
+		if err != nil {
+			return data, fmt.Errorf("%s: %w", p.names[i], err)
+		}
+		data = out
+	}
+	return data, nil
+}
+
+// pipelineResult is a message's payload after the decode pipeline
+type pipelineResult struct {
+	data []byte
+	err  error
+}
+
+// pipelineCache keeps the pipeline's output per message seq, since the
+// messages pane decodes every visible message on every render. It belongs
+// to one pipeline and is dropped with it.
+type pipelineCache struct {
+	pipeline *DecodePipeline
+	results  map[uint64]pipelineResult
+}
+
+// applyPipeline runs a message's payload through the decode pipeline,
+// reusing the result for a buffered message until its payload changes
+func (ui *UI) applyPipeline(msg Message, data []byte) ([]byte, error) {
+	if msg.Seq == 0 {
+		return ui.pipeline.Apply(data)
+	}
+	if ui.pipelineCache.pipeline != ui.pipeline || ui.pipelineCache.results == nil {
+		ui.pipelineCache = pipelineCache{pipeline: ui.pipeline, results: make(map[uint64]pipelineResult)}
+	}
+	if result, ok := ui.pipelineCache.results[msg.Seq]; ok {
+		return result.data, result.err
+	}
+	decoded, err := ui.pipeline.Apply(data)
+	ui.pipelineCache.results[msg.Seq] = pipelineResult{data: decoded, err: err}
+	return decoded, err
+}
+
+// gunzipStep decompresses a gzip payload
+func gunzipStep(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	out, err := io.ReadAll(io.LimitReader(r, maxGunzipBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(out) > maxGunzipBytes {
+		return nil, fmt.Errorf("decompresses to more than %s", formatBytes(maxGunzipBytes))
+	}
+	return out, nil
+}
+
+// jsonPrettyStep indents a JSON payload
+func jsonPrettyStep(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, data, "", "  "); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
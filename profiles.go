@@ -0,0 +1,264 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// errProfileCancelled is returned when the profile picker is left without a choice
+var errProfileCancelled = errors.New("no profile selected")
+
+// Profile is a named broker in the profiles file
+type Profile struct {
+	Name      string `json:"name"`
+	BrokerURL string `json:"broker_url"`
+	Username  string `json:"username,omitempty"`
+	Password  string `json:"password,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+}
+
+// profilesPath returns the location of the profiles file
+func profilesPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "mqttui", "profiles.json"), nil
+}
+
+// LoadProfiles reads the profiles file. A missing file means no profiles.
+func LoadProfiles(path string) ([]Profile, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var profiles []Profile
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return nil, err
+	}
+	for i, p := range profiles {
+		if p.Name == "" {
+			return nil, fmt.Errorf("profile %d has no name", i+1)
+		}
+	}
+	return profiles, nil
+}
+
+// profileConfigs applies each profile to the configuration from the environment
+func profileConfigs(base Config, profiles []Profile) []Config {
+	configs := make([]Config, len(profiles))
+	for i, p := range profiles {
+		configs[i] = applyProfile(base, p)
+	}
+	return configs
+}
+
+// applyProfile fills the connection settings from a profile. A setting given
+// as a flag or in the environment still wins, and one the profile leaves out
+// keeps its default.
+func applyProfile(config Config, p Profile) Config {
+	config.Profile = p.Name
+	setFromProfile(&config.BrokerURL, "MQTT_BROKER", p.BrokerURL)
+	setFromProfile(&config.Username, "MQTT_USERNAME", p.Username)
+	setFromProfile(&config.Password, "MQTT_PASSWORD", p.Password)
+	setFromProfile(&config.ClientID, "MQTT_CLIENT_ID", p.ClientID)
+	return config
+}
+
+// setFromProfile sets a field to the profile's value unless a flag or the
+// environment variable overriding it is set
+func setFromProfile(field *string, envKey, value string) {
+	if _, set := lookupSetting(envKey); !set && value != "" {
+		*field = value
+	}
+}
+
+// pickerEntry is a line of the profile picker: a profile, the configuration
+// from the environment or a recently used broker
+type pickerEntry struct {
+	Name   string
+	Detail string
+	Config Config
+	Recent bool
+}
+
+// applyRecentBroker fills the connection settings from a recent broker,
+// leaving flags and the environment to win like a profile's settings do
+func applyRecentBroker(config Config, r RecentBroker) Config {
+	setFromProfile(&config.BrokerURL, "MQTT_BROKER", r.BrokerURL)
+	setFromProfile(&config.Username, "MQTT_USERNAME", r.Username)
+	setFromProfile(&config.ClientID, "MQTT_CLIENT_ID", r.ClientID)
+	return config
+}
+
+// recentEntries returns picker entries for the recent brokers not already
+// listed. A broker given as a flag or in the environment leaves nothing to
+// pick, so there are none then.
+func recentEntries(base Config, listed []pickerEntry) []pickerEntry {
+	if _, set := lookupSetting("MQTT_BROKER"); set {
+		return nil
+	}
+	path, err := recentBrokersPath()
+	if err != nil {
+		return nil
+	}
+	recent, err := LoadRecentBrokers(path)
+	if err != nil {
+		logError("Reading %s: %v", path, err)
+		return nil
+	}
+	var entries []pickerEntry
+	for _, r := range recent {
+		if slices.ContainsFunc(listed, func(e pickerEntry) bool { return e.Config.BrokerURL == r.BrokerURL }) {
+			continue
+		}
+		detail := "used " + r.LastUsed.Local().Format("2006-01-02 15:04")
+		if r.Username != "" {
+			detail += " as " + r.Username
+		}
+		entries = append(entries, pickerEntry{Name: r.BrokerURL, Detail: detail, Config: applyRecentBroker(base, r), Recent: true})
+	}
+	return entries
+}
+
+// resolveProfile picks the profile to connect with: the named one, the only
+// one, or the user's choice from a picker when interactive, which also
+// offers the recently used brokers. Without a profiles file or recent
+// brokers the configuration is used as is.
+func resolveProfile(base Config, name string, interactive bool) (Config, error) {
+	path, err := profilesPath()
+	if err != nil {
+		if name != "" {
+			return base, err
+		}
+		return base, nil
+	}
+	profiles, err := LoadProfiles(path)
+	if err != nil {
+		return base, fmt.Errorf("reading %s: %w", path, err)
+	}
+	configs := profileConfigs(base, profiles)
+
+	if name != "" {
+		for _, config := range configs {
+			if config.Profile == name {
+				return config, nil
+			}
+		}
+		return base, fmt.Errorf("no profile named %q in %s", name, path)
+	}
+
+	var entries []pickerEntry
+	for _, config := range configs {
+		entries = append(entries, pickerEntry{Name: config.Profile, Detail: config.BrokerURL, Config: config})
+	}
+	var recent []pickerEntry
+	if interactive {
+		// Without profiles the environment's broker is the first choice
+		listed := entries
+		if len(listed) == 0 {
+			listed = []pickerEntry{{Name: "default", Detail: base.BrokerURL, Config: base}}
+		}
+		recent = recentEntries(base, listed)
+		if len(recent) > 0 {
+			entries = append(listed, recent...)
+		}
+	}
+
+	switch {
+	case len(configs) == 0 && len(recent) == 0:
+		return base, nil
+	case len(configs) == 1 && len(recent) == 0:
+		return configs[0], nil
+	case !interactive:
+		return base, fmt.Errorf("%d profiles in %s, choose one with --profile", len(configs), path)
+	}
+	// The picker follows MQTT_THEME, NO_COLOR and MQTT_MINIMAL like the UI
+	styles := themeStyles(resolveTheme(base.Theme))
+	if base.Minimal {
+		styles = minimalStyles()
+	}
+	return pickProfile(entries, styles)
+}
+
+// pickProfile shows the profile picker, styled like the UI, and returns the
+// chosen entry's configuration
+func pickProfile(entries []pickerEntry, styles Styles) (Config, error) {
+	picker := &profilePicker{entries: entries, styles: styles}
+	model, err := tea.NewProgram(picker, tea.WithAltScreen()).Run()
+	if err != nil {
+		return Config{}, err
+	}
+	picker = model.(*profilePicker)
+	if !picker.chosen {
+		return Config{}, errProfileCancelled
+	}
+	return entries[picker.selected].Config, nil
+}
+
+// profilePicker is the startup list for choosing a profile, or a recent
+// broker, before connecting
+type profilePicker struct {
+	entries  []pickerEntry
+	styles   Styles
+	selected int
+	chosen   bool
+}
+
+// Init implements tea.Model
+func (p *profilePicker) Init() tea.Cmd {
+	return nil
+}
+
+// Update implements tea.Model
+func (p *profilePicker) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	key, ok := msg.(tea.KeyMsg)
+	if !ok {
+		return p, nil
+	}
+	switch key.String() {
+	case "up", "k":
+		if p.selected > 0 {
+			p.selected--
+		}
+	case "down", "j":
+		if p.selected < len(p.entries)-1 {
+			p.selected++
+		}
+	case "enter", " ":
+		p.chosen = true
+		return p, tea.Quit
+	case "q", "esc", "ctrl+c":
+		return p, tea.Quit
+	}
+	return p, nil
+}
+
+// View implements tea.Model
+func (p *profilePicker) View() string {
+	muted := p.styles.UnselectedItem
+	lines := []string{p.styles.Title.Render("MQTT TUI Browser • choose a profile"), ""}
+	for i, entry := range p.entries {
+		if entry.Recent && (i == 0 || !p.entries[i-1].Recent) {
+			lines = append(lines, "", muted.Render("Recent brokers"))
+		}
+		cursor, name := "  ", entry.Name
+		if i == p.selected {
+			cursor, name = "▶ ", p.styles.SelectedItem.Render(name)
+		}
+		lines = append(lines, cursor+name+"  "+muted.Render(entry.Detail))
+	}
+	lines = append(lines, "", p.styles.Help.Render("↑/↓ choose • enter connect • q quit"))
+	return strings.Join(lines, "\n")
+}
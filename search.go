@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// setSearch sets the text searched for in message payloads, compiled to a
+// literal pattern that ignores case unless case-sensitive search is on
+func (ui *UI) setSearch(text string) {
+	ui.search = text
+	ui.searchIndex = 0
+	ui.searchRe = nil
+	ui.invalidateSearch()
+	if text == "" {
+		return
+	}
+	expr := regexp.QuoteMeta(text)
+	if !ui.searchCase {
+		expr = "(?i)" + expr
+	}
+	ui.searchRe = regexp.MustCompile(expr)
+}
+
+// toggleSearchCase switches between case-insensitive and case-sensitive search
+func (ui *UI) toggleSearchCase() {
+	ui.searchCase = !ui.searchCase
+	ui.setSearch(ui.search)
+}
+
+// searchMatches returns the indices of the visible messages whose payload
+// contains the search text. The title asks on every frame, so the list is
+// kept until the search, the filters or the buffer change.
+func (ui *UI) searchMatches() []int {
+	if ui.searchRe == nil {
+		return nil
+	}
+	if !ui.searchCached {
+		ui.searchHits = nil
+		for _, i := range ui.visibleMessages() {
+			if ui.searchRe.MatchString(displayPayload(ui.messages[i])) {
+				ui.searchHits = append(ui.searchHits, i)
+			}
+		}
+		ui.searchCached = true
+	}
+	return ui.searchHits
+}
+
+// invalidateSearch drops the cached search matches, to be found again on
+// the next render
+func (ui *UI) invalidateSearch() {
+	ui.searchCached = false
+	ui.searchHits = nil
+}
+
+// addSearchMatch adds the message at index i, newly appended to the buffer,
+// to the cached matches when it is visible and matches
+func (ui *UI) addSearchMatch(i int) {
+	if !ui.searchCached || !ui.messageVisible(ui.messages[i]) {
+		return
+	}
+	if ui.searchRe.MatchString(displayPayload(ui.messages[i])) {
+		ui.searchHits = append(ui.searchHits, i)
+	}
+}
+
+// dropSearchMatches updates the cached matches for the n oldest messages
+// leaving the buffer
+func (ui *UI) dropSearchMatches(n int) {
+	if !ui.searchCached {
+		return
+	}
+	k := 0
+	for k < len(ui.searchHits) && ui.searchHits[k] < n {
+		k++
+	}
+	ui.searchHits = ui.searchHits[k:]
+	for j := range ui.searchHits {
+		ui.searchHits[j] -= n
+	}
+}
+
+// jumpToMatch selects the next (dir 1) or previous (dir -1) message matching
+// the search, wrapping around; rendering scrolls it into view
+func (ui *UI) jumpToMatch(dir int) {
+	matches := ui.searchMatches()
+	if len(matches) == 0 {
+		return
+	}
+	next := -1
+	if dir > 0 {
+		next = 0
+		for k, i := range matches {
+			if i > ui.selectedMessage {
+				next = k
+				break
+			}
+		}
+	} else {
+		next = len(matches) - 1
+		for k := len(matches) - 1; k >= 0; k-- {
+			if matches[k] < ui.selectedMessage {
+				next = k
+				break
+			}
+		}
+	}
+	ui.searchIndex = next + 1
+	ui.selectedMessage = matches[next]
+	ui.activePane = MessagesPane
+	if ui.atLatest() {
+		ui.newBelow = 0
+	}
+}
+
+// searchTitle describes the search for the messages title: the text, the
+// current match and the number of matches
+func (ui *UI) searchTitle() string {
+	if ui.search == "" {
+		return ""
+	}
+	mode := ""
+	if ui.searchCase {
+		mode = " Aa"
+	}
+	matches := len(ui.searchMatches())
+	if ui.searchIndex > 0 && ui.searchIndex <= matches {
+		return fmt.Sprintf(" [search %q%s %d/%d]", ui.search, mode, ui.searchIndex, matches)
+	}
+	return fmt.Sprintf(" [search %q%s %d]", ui.search, mode, matches)
+}
+
+// highlightMatches marks every occurrence of the search text in a line of
+// payload
+func (ui *UI) highlightMatches(line string) string {
+	if ui.searchRe == nil {
+		return line
+	}
+	return ui.searchRe.ReplaceAllStringFunc(line, func(match string) string {
+		return ui.styles.Match.Render(match)
+	})
+}
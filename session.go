@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// SessionState is what a session file keeps between runs
+type SessionState struct {
+	Topics   []string         `json:"topics"`
+	Messages []SessionMessage `json:"messages"`
+}
+
+// SessionMessage is a buffered message in a session file; the payload is
+// stored as raw bytes (base64 in JSON) so binary payloads survive
+type SessionMessage struct {
+	Topic     string    `json:"topic"`
+	Payload   []byte    `json:"payload"`
+	QoS       byte      `json:"qos"`
+	Retained  bool      `json:"retained,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// LoadSession reads a session file. A missing file is an empty session.
+func LoadSession(path string) (*SessionState, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &SessionState{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var state SessionState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// SaveSession writes the discovered topics and the message buffer to a
+// session file, replacing it atomically
+func (a *App) SaveSession(path string) error {
+	seen := make(map[string]bool)
+	var topics []string
+	for _, topic := range a.ui.topics {
+		seen[topic] = true
+		topics = append(topics, topic)
+	}
+	if a.mqtt != nil {
+		for _, topic := range a.mqtt.GetDiscoveredTopics() {
+			if !seen[topic] {
+				topics = append(topics, topic)
+			}
+		}
+	}
+	sort.Strings(topics)
+
+	state := SessionState{Topics: topics}
+	for _, msg := range a.ui.messages {
+		state.Messages = append(state.Messages, SessionMessage{
+			Topic:     msg.Topic,
+			Payload:   payloadBytes(msg),
+			QoS:       msg.QoS,
+			Retained:  msg.Retained,
+			Timestamp: msg.Timestamp,
+		})
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return err
+		}
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// restoreSession loads the configured session file into the interface; a
+// corrupt file is skipped with a warning
+func (a *App) restoreSession() {
+	state, err := LoadSession(a.config.SessionFile)
+	if err != nil {
+		logError("Ignoring unreadable session file %s: %v", a.config.SessionFile, err)
+		return
+	}
+
+	a.ui.SetTopics(state.Topics)
+	if a.mqtt != nil {
+		a.mqtt.AddDiscoveredTopics(state.Topics)
+	}
+	for _, msg := range state.Messages {
+		a.ui.AddMessage(Message{
+			Topic:     msg.Topic,
+			Payload:   string(msg.Payload),
+			Raw:       msg.Payload,
+			QoS:       msg.QoS,
+			Retained:  msg.Retained,
+			Timestamp: msg.Timestamp,
+		})
+	}
+}
+
+// saveSession writes the configured session file, if any
+func (a *App) saveSession() {
+	if a.config.SessionFile == "" {
+		return
+	}
+	if err := a.SaveSession(a.config.SessionFile); err != nil {
+		logError("Failed to save session: %v", err)
+	}
+}
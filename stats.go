@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// rateWindow is how far back message rates look
+const rateWindow = 10
+
+// rateCounter counts events in one-second buckets over the last rateWindow
+// seconds, so a rate costs constant memory however busy a topic is
+type rateCounter struct {
+	buckets [rateWindow]int
+	seconds [rateWindow]int64
+}
+
+// add counts an event at t
+func (r *rateCounter) add(t time.Time) {
+	sec := t.Unix()
+	i := sec % rateWindow
+	if r.seconds[i] != sec {
+		r.seconds[i] = sec
+		r.buckets[i] = 0
+	}
+	r.buckets[i]++
+}
+
+// rate returns the events per second over the window ending at now
+func (r *rateCounter) rate(now time.Time) float64 {
+	sec := now.Unix()
+	total := 0
+	for i, bucketSec := range r.seconds {
+		if bucketSec > sec-rateWindow && bucketSec <= sec {
+			total += r.buckets[i]
+		}
+	}
+	return float64(total) / rateWindow
+}
+
+// throughputSample is the received message count at a point in time
+type throughputSample struct {
+	at       time.Time
+	messages uint64
+}
+
+// throughputWindow keeps the received totals sampled on each tick over the
+// last rateWindow seconds, for the overall message rate
+type throughputWindow struct {
+	samples  []throughputSample
+	messages uint64
+	bytes    uint64
+}
+
+// sample records the received totals at now, dropping samples that fell
+// out of the window
+func (w *throughputWindow) sample(now time.Time, messages, bytes uint64) {
+	if messages < w.messages {
+		// A new client counts from zero again
+		w.samples = nil
+	}
+	w.messages, w.bytes = messages, bytes
+	w.samples = append(w.samples, throughputSample{at: now, messages: messages})
+	cutoff := now.Add(-rateWindow * time.Second)
+	for len(w.samples) > 2 && w.samples[1].at.Before(cutoff) {
+		w.samples = w.samples[1:]
+	}
+}
+
+// rate returns the messages per second between the oldest and newest samples
+func (w *throughputWindow) rate() float64 {
+	if len(w.samples) < 2 {
+		return 0
+	}
+	first, last := w.samples[0], w.samples[len(w.samples)-1]
+	elapsed := last.at.Sub(first.at).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(last.messages-first.messages) / elapsed
+}
+
+// summary describes the totals and current rate for the status bar
+func (w *throughputWindow) summary() string {
+	return fmt.Sprintf("%d msgs • %s • %.1f msg/s", w.messages, formatBytes(int(w.bytes)), w.rate())
+}
+
+// SampleThroughput records the received totals for the status bar
+func (ui *UI) SampleThroughput(messages, bytes uint64) {
+	ui.throughput.sample(time.Now(), messages, bytes)
+}
+
+// counts returns the events in each second of the window ending at now,
+// oldest first
+func (r *rateCounter) counts(now time.Time) [rateWindow]int {
+	var counts [rateWindow]int
+	sec := now.Unix()
+	for k := range counts {
+		s := sec - rateWindow + 1 + int64(k)
+		if i := s % rateWindow; r.seconds[i] == s {
+			counts[k] = r.buckets[i]
+		}
+	}
+	return counts
+}
+
+// sparkLevels are the block characters of a sparkline, lowest first; a
+// second without events is blank
+var sparkLevels = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline draws counts scaled to the largest of them
+func sparkline(counts []int) string {
+	peak := 0
+	for _, n := range counts {
+		peak = max(peak, n)
+	}
+	line := make([]rune, len(counts))
+	for k, n := range counts {
+		if n == 0 {
+			line[k] = ' '
+			continue
+		}
+		line[k] = sparkLevels[(n*len(sparkLevels)-1)/peak]
+	}
+	return string(line)
+}
+
+// minSparklineWidth is the narrowest topics pane that still shows sparklines
+const minSparklineWidth = 40
+
+// topicSparkline draws a topic's messages per second over the rate window,
+// or nothing when sparklines are off or the pane is too narrow for them
+func (ui *UI) topicSparkline(topic string, width int) string {
+	if !ui.sparklines || width < minSparklineWidth {
+		return ""
+	}
+	counts := [rateWindow]int{}
+	if stats, ok := ui.topicStats[topic]; ok {
+		counts = stats.rate.counts(time.Now())
+	}
+	return " " + sparkline(counts[:])
+}
+
+// statsTickMsg redraws the topic stats so rates decay when traffic stops,
+// relative message times so they keep aging and the connection uptime;
+// ticks of an earlier toggle are dropped so only one tick runs at a time
+type statsTickMsg struct {
+	id int
+}
+
+// ticking reports whether anything on screen changes by the second: topic
+// rates and sparklines, relative message times, activity highlights, the
+// connection uptime or messages expiring
+func (ui *UI) ticking() bool {
+	return ui.showStats || ui.sparklines || ui.timeLayout == relativeTimeFormat || ui.activityWindow > 0 ||
+		ui.connStatus == StatusConnected || ui.connStatus == StatusStalled || ui.messageTTL > 0
+}
+
+// recentlyActive reports whether a topic received a message within the
+// activity window
+func (ui *UI) recentlyActive(topic string) bool {
+	stats, ok := ui.topicStats[topic]
+	return ok && ui.activityWindow > 0 && time.Since(stats.LastActivity) < ui.activityWindow
+}
+
+// RestartTick starts the once-a-second redraw, replacing any running one
+func (ui *UI) RestartTick() tea.Cmd {
+	ui.statsTickID++
+	return statsTick(ui.statsTickID)
+}
+
+// statsTick schedules the next stats redraw
+func statsTick(id int) tea.Cmd {
+	return tea.Tick(time.Second, func(time.Time) tea.Msg {
+		return statsTickMsg{id: id}
+	})
+}
+
+// topicStatsSummary describes a topic's message count and current rate
+func (ui *UI) topicStatsSummary(topic string) string {
+	stats, ok := ui.topicStats[topic]
+	if !ok {
+		return "  (0, 0.0/s)"
+	}
+	return fmt.Sprintf("  (%d, %.1f/s)", stats.Count, stats.rate.rate(time.Now()))
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// SavedSubscriptions is a broker's subscriptions as kept between runs.
+// Topics holds every subscription, Filters the ones typed in with s, which
+// stay listed even when unsubscribed.
+type SavedSubscriptions struct {
+	Topics  []string `json:"topics"`
+	Filters []string `json:"filters,omitempty"`
+}
+
+// subscriptionsPath returns the location of the saved subscriptions file
+func subscriptionsPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "mqttui", "subscriptions.json"), nil
+}
+
+// LoadSubscriptions reads the saved subscriptions, keyed by broker URL. A
+// missing file has none.
+func LoadSubscriptions(path string) (map[string]SavedSubscriptions, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]SavedSubscriptions{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	saved := map[string]SavedSubscriptions{}
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, err
+	}
+	return saved, nil
+}
+
+// SaveSubscriptions replaces a broker's saved subscriptions, keeping the
+// other brokers'
+func SaveSubscriptions(path, broker string, subs SavedSubscriptions) error {
+	saved, err := LoadSubscriptions(path)
+	if err != nil {
+		// Start over rather than failing on a corrupt file
+		saved = map[string]SavedSubscriptions{}
+	}
+	if len(subs.Topics) == 0 && len(subs.Filters) == 0 {
+		delete(saved, broker)
+	} else {
+		saved[broker] = subs
+	}
+
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// currentSubscriptions returns the interface's subscriptions in the form
+// they are saved
+func (a *App) currentSubscriptions() SavedSubscriptions {
+	topics := a.ui.GetSubscribedTopics()
+	sort.Strings(topics)
+	return SavedSubscriptions{
+		Topics:  topics,
+		Filters: slices.Clone(a.ui.explicitFilters),
+	}
+}
+
+// restoreSubscriptions subscribes again to the topics saved for the broker
+// by the previous run; from then on changes are saved as they happen
+func (a *App) restoreSubscriptions() []tea.Cmd {
+	if a.subsRestored {
+		return nil
+	}
+	a.subsRestored = true
+
+	path, err := subscriptionsPath()
+	var saved map[string]SavedSubscriptions
+	if err == nil {
+		saved, err = LoadSubscriptions(path)
+	}
+	if err != nil {
+		logError("Ignoring saved subscriptions: %v", err)
+		return nil
+	}
+
+	subs := saved[a.config.BrokerURL]
+	for _, filter := range subs.Filters {
+		a.ui.addExplicitFilter(filter)
+	}
+	var cmds []tea.Cmd
+	for _, topic := range subs.Topics {
+		if validateTopicFilter(topic) != nil {
+			continue
+		}
+		a.ui.SetTopicSubscribed(topic, true)
+		cmds = append(cmds, a.subscribeToTopicCmd(topic))
+	}
+	a.savedSubs = a.currentSubscriptions()
+	return limitConcurrency(cmds, maxSubscribeWorkers)
+}
+
+// persistSubscriptions saves the subscriptions when they differ from the
+// last saved ones
+func (a *App) persistSubscriptions() {
+	if !a.subsRestored {
+		return
+	}
+	current := a.currentSubscriptions()
+	if slices.Equal(current.Topics, a.savedSubs.Topics) && slices.Equal(current.Filters, a.savedSubs.Filters) {
+		return
+	}
+	a.savedSubs = current
+
+	path, err := subscriptionsPath()
+	if err == nil {
+		err = SaveSubscriptions(path, a.config.BrokerURL, current)
+	}
+	if err != nil {
+		logError("Failed to save subscriptions: %v", err)
+	}
+}
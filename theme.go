@@ -0,0 +1,126 @@
+package main
+
+import (
+	"os"
+	"slices"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Theme holds the colors the styles are built from; an empty color leaves
+// the terminal's default
+type Theme struct {
+	Name       string
+	Accent     lipgloss.Color // Titles, message topics, active pane border
+	Border     lipgloss.Color // Inactive pane borders
+	Text       lipgloss.Color // Subscribed topics
+	Muted      lipgloss.Color // Unsubscribed topics, times, help
+	SelectedFg lipgloss.Color
+	SelectedBg lipgloss.Color
+	Active     lipgloss.Color // Recently active topics
+	Notice     lipgloss.Color
+	Error      lipgloss.Color
+	WatchFg    lipgloss.Color
+	WatchBg    lipgloss.Color
+}
+
+// themes are the presets MQTT_THEME chooses from
+var themes = []Theme{
+	{
+		Name:       "dark",
+		Accent:     "205",
+		Border:     "240",
+		Text:       "252",
+		Muted:      "241",
+		SelectedFg: "170",
+		SelectedBg: "57",
+		Active:     "42",
+		Notice:     "42",
+		Error:      "196",
+		WatchFg:    "0",
+		WatchBg:    "214",
+	},
+	{
+		Name:       "light",
+		Accent:     "125",
+		Border:     "250",
+		Text:       "235",
+		Muted:      "243",
+		SelectedFg: "231",
+		SelectedBg: "25",
+		Active:     "28",
+		Notice:     "28",
+		Error:      "160",
+		WatchFg:    "0",
+		WatchBg:    "220",
+	},
+	{Name: "mono"},
+}
+
+// resolveTheme returns the named theme; NO_COLOR forces mono and an unknown
+// name is logged and falls back to dark
+func resolveTheme(name string) Theme {
+	if os.Getenv("NO_COLOR") != "" {
+		name = "mono"
+	}
+	i := slices.IndexFunc(themes, func(t Theme) bool { return t.Name == name })
+	if i < 0 {
+		logError("Invalid value for MQTT_THEME: %q, must be dark, light or mono, using dark", name)
+		i = 0
+	}
+	return themes[i]
+}
+
+// colorless reports whether a theme leaves everything uncolored
+func (t Theme) colorless() bool {
+	return t == Theme{Name: t.Name}
+}
+
+// themeStyles builds the UI styles from a theme's colors
+func themeStyles(t Theme) Styles {
+	fg := func(style lipgloss.Style, c lipgloss.Color) lipgloss.Style {
+		if c == "" {
+			return style
+		}
+		return style.Foreground(c)
+	}
+	bordered := func(c lipgloss.Color) lipgloss.Style {
+		style := lipgloss.NewStyle().Border(lipgloss.RoundedBorder())
+		if c == "" {
+			return style
+		}
+		return style.BorderForeground(c)
+	}
+	// Without colors, selection and highlights fall back to attributes
+	selected := fg(lipgloss.NewStyle(), t.SelectedFg).Bold(true)
+	watch := fg(lipgloss.NewStyle(), t.WatchFg).Bold(true)
+	if t.SelectedBg == "" {
+		selected = selected.Reverse(true)
+	} else {
+		selected = selected.Background(t.SelectedBg)
+	}
+	if t.WatchBg == "" {
+		watch = watch.Reverse(true)
+	} else {
+		watch = watch.Background(t.WatchBg)
+	}
+
+	return Styles{
+		Border:         bordered(t.Border),
+		Title:          fg(lipgloss.NewStyle(), t.Accent).Bold(true).Padding(0, 1),
+		SelectedItem:   selected,
+		UnselectedItem: fg(lipgloss.NewStyle(), t.Muted),
+		SubscribedItem: fg(lipgloss.NewStyle(), t.Text),
+		ActiveItem:     fg(lipgloss.NewStyle(), t.Active).Bold(true),
+		Message:        lipgloss.NewStyle().Padding(0, 1).Margin(0, 0, 1, 0),
+		MessageTopic:   fg(lipgloss.NewStyle(), t.Accent).Bold(true),
+		MessageTime:    fg(lipgloss.NewStyle(), t.Muted),
+		Error:          fg(lipgloss.NewStyle(), t.Error).Bold(true),
+		Notice:         fg(lipgloss.NewStyle(), t.Notice),
+		Help:           fg(lipgloss.NewStyle(), t.Muted).Italic(true),
+		Watch:          watch,
+		Match:          watch.UnsetBold(),
+		ActivePane:     bordered(t.Accent),
+		InactivePane:   bordered(t.Border),
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/mattn/go-runewidth"
+)
+
+// maxThreadMessages caps the older messages listed under an expanded thread
+const maxThreadMessages = 20
+
+// messageThread is a topic's visible messages, oldest first
+type messageThread struct {
+	Topic   string
+	Indexes []int
+}
+
+// messageThreads groups the visible messages by topic, the thread with the
+// most recent message first
+func (ui *UI) messageThreads() []messageThread {
+	var threads []messageThread
+	byTopic := make(map[string]int)
+	visible := ui.visibleMessages()
+	for _, i := range visible {
+		topic := ui.messages[i].Topic
+		t, ok := byTopic[topic]
+		if !ok {
+			t = len(threads)
+			byTopic[topic] = t
+			threads = append(threads, messageThread{Topic: topic})
+		}
+		threads[t].Indexes = append(threads[t].Indexes, i)
+	}
+
+	// Order by each thread's newest message, most recent first
+	latest := func(t messageThread) int { return t.Indexes[len(t.Indexes)-1] }
+	sort.Slice(threads, func(i, j int) bool {
+		return latest(threads[i]) > latest(threads[j])
+	})
+	return threads
+}
+
+// selectedThreadIndex returns the position of the selected thread; threads
+// reorder as messages arrive, so the selection follows its topic
+func (ui *UI) selectedThreadIndex(threads []messageThread) int {
+	for i, thread := range threads {
+		if thread.Topic == ui.selectedThread {
+			return i
+		}
+	}
+	return 0
+}
+
+// moveThreadSelection selects the thread dir positions away from the selected one
+func (ui *UI) moveThreadSelection(dir int) {
+	threads := ui.messageThreads()
+	if len(threads) == 0 {
+		return
+	}
+	i := ui.selectedThreadIndex(threads) + dir
+	i = max(0, min(i, len(threads)-1))
+	ui.selectedThread = threads[i].Topic
+}
+
+// toggleSelectedThread expands or collapses the selected thread
+func (ui *UI) toggleSelectedThread() {
+	threads := ui.messageThreads()
+	if len(threads) > 0 {
+		topic := threads[ui.selectedThreadIndex(threads)].Topic
+		ui.expandedThreads[topic] = !ui.expandedThreads[topic]
+	}
+}
+
+// threadLine renders a message as a single line under its thread
+func (ui *UI) threadLine(msg Message, width int) string {
+	timeStr := ui.formatTime(msg.Timestamp)
+	payloadWidth := width - runewidth.StringWidth(timeStr) - 5
+	if payloadWidth < 10 {
+		payloadWidth = 10
+	}
+	// Only the preview is flattened, however large the payload
+	preview, _ := ui.previewPayload(msg)
+	payload := runewidth.Truncate(strings.Join(strings.Fields(sanitizePayload(displayPayload(preview))), " "), payloadWidth, "…")
+	return "    " + ui.styles.MessageTime.Render(timeStr) + " " + payload
+}
+
+// renderThreadsPane renders messages grouped into collapsible per-topic
+// threads: each shows its latest message, expanded ones their older messages too
+func (ui *UI) renderThreadsPane(width, height int) string {
+	threads := ui.messageThreads()
+	title := fmt.Sprintf("Threads (%d)", len(threads))
+
+	selected := ui.selectedThreadIndex(threads)
+
+	availableLines := height - 3
+	if availableLines < 1 {
+		availableLines = 1
+	}
+
+	var lines []string
+	selectedLine := 0
+	for t, thread := range threads {
+		expanded := ui.expandedThreads[thread.Topic]
+		arrow := "▸"
+		if expanded {
+			arrow = "▾"
+		}
+		header := runewidth.Truncate(fmt.Sprintf("%s %s (%d)", arrow, thread.Topic, len(thread.Indexes)), width-4, "…")
+		if t == selected {
+			selectedLine = len(lines)
+			if ui.activePane == MessagesPane {
+				header = ui.styles.SelectedItem.Width(width - 2).Render(header)
+			} else {
+				header = ui.topicStyle(thread.Topic).Render(header)
+			}
+		} else {
+			header = ui.topicStyle(thread.Topic).Render(header)
+		}
+		lines = append(lines, header)
+
+		// Newest first; collapsed threads only show the latest message
+		shown := 1
+		if expanded {
+			shown = min(len(thread.Indexes), maxThreadMessages)
+		}
+		for n := 0; n < shown; n++ {
+			msg := ui.messages[thread.Indexes[len(thread.Indexes)-1-n]]
+			lines = append(lines, ui.threadLine(msg, width-4))
+		}
+		if hidden := len(thread.Indexes) - shown; expanded && hidden > 0 {
+			lines = append(lines, ui.styles.Help.Render(fmt.Sprintf("    … %d older", hidden)))
+		}
+	}
+	if len(threads) == 0 {
+		lines = append(lines, ui.styles.UnselectedItem.Render("No messages yet..."))
+	}
+
+	// Keep the selected thread's header in view
+	if selectedLine < ui.threadScroll {
+		ui.threadScroll = selectedLine
+	} else if selectedLine >= ui.threadScroll+availableLines {
+		ui.threadScroll = selectedLine - availableLines + 1
+	}
+	if ui.threadScroll > 0 {
+		title += " ↑"
+	}
+	end := min(ui.threadScroll+availableLines, len(lines))
+	if end < len(lines) {
+		title += " ↓"
+	}
+	lines = lines[min(ui.threadScroll, end):end]
+
+	style := ui.styles.InactivePane
+	if ui.activePane == MessagesPane {
+		style = ui.styles.ActivePane
+		title = ui.activeTitle(title)
+	}
+
+	return style.
+		Width(width).
+		Height(height).
+		Render(lipgloss.JoinVertical(
+			lipgloss.Left,
+			ui.styles.Title.Render(title),
+			strings.Join(lines, "\n"),
+		))
+}
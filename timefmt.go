@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// relativeTimeFormat shows message times as ages, e.g. "3s ago"
+const relativeTimeFormat = "relative"
+
+// referenceTime is Go's layout reference time, used to size layouts
+var referenceTime = time.Date(2006, time.January, 2, 15, 4, 5, 999999999, time.UTC)
+
+// probeTime differs from the reference time in every field, so formatting
+// it changes any layout that has layout elements
+var probeTime = time.Date(2011, time.November, 22, 3, 33, 44, 0, time.UTC)
+
+// resolveTimeFormat returns the layout for message times: a custom Go
+// layout, "relative", or the layout for the timestamp precision. A format
+// without any layout elements is rejected with a warning.
+func resolveTimeFormat(format, precision string) string {
+	if format == "" || format == relativeTimeFormat {
+		if format == "" {
+			return timestampLayout(precision)
+		}
+		return format
+	}
+	if probeTime.Format(format) == format {
+		logError("Invalid value for MQTT_TIME_FORMAT: %q has no time layout elements, using default", format)
+		return timestampLayout(precision)
+	}
+	return format
+}
+
+// resolveTimeZone loads the zone message times are shown in, the local zone
+// when none or an unknown one is configured
+func resolveTimeZone(name string) *time.Location {
+	if name == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		logError("Invalid value for MQTT_TZ: %v, using local time", err)
+		return time.Local
+	}
+	return loc
+}
+
+// formatTime formats a message time with the configured layout and zone
+func (ui *UI) formatTime(t time.Time) string {
+	if ui.timeLayout == relativeTimeFormat {
+		return relativeAge(time.Since(t))
+	}
+	return t.In(ui.timeZone).Format(ui.timeLayout)
+}
+
+// timeWidth returns the display width of formatted message times
+func (ui *UI) timeWidth() int {
+	if ui.timeLayout == relativeTimeFormat {
+		return len("59m ago")
+	}
+	return len(referenceTime.Format(ui.timeLayout))
+}
+
+// relativeAge renders a duration as a short age in its largest unit
+func relativeAge(d time.Duration) string {
+	switch {
+	case d < time.Second:
+		return "now"
+	case d < time.Minute:
+		return fmt.Sprintf("%ds ago", int(d/time.Second))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d/time.Minute))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d/time.Hour))
+	}
+	return fmt.Sprintf("%dd ago", int(d/(24*time.Hour)))
+}
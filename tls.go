@@ -0,0 +1,59 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// tlsSchemes are the broker URL schemes paho connects to over TLS
+var tlsSchemes = map[string]bool{
+	"ssl":      true,
+	"tls":      true,
+	"mqtts":    true,
+	"mqtt+ssl": true,
+	"tcps":     true,
+	"wss":      true,
+}
+
+// isTLSBroker reports whether a broker URL uses a TLS scheme
+func isTLSBroker(broker string) bool {
+	u, err := url.Parse(strings.TrimSpace(broker))
+	return err == nil && tlsSchemes[strings.ToLower(u.Scheme)]
+}
+
+// newTLSConfig builds the TLS configuration from the CA and client
+// certificate settings, reporting missing or malformed PEM files
+func newTLSConfig(config Config) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: config.TLSInsecure,
+	}
+
+	if config.CACertPath != "" {
+		pem, err := os.ReadFile(config.CACertPath)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA certificate: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM certificates found in CA certificate %s", config.CACertPath)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if config.ClientCertPath != "" || config.ClientKeyPath != "" {
+		if config.ClientCertPath == "" || config.ClientKeyPath == "" {
+			return nil, fmt.Errorf("client certificates need both MQTT_CLIENT_CERT and MQTT_CLIENT_KEY")
+		}
+		cert, err := tls.LoadX509KeyPair(config.ClientCertPath, config.ClientKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// topicsFilePoll is how often the topics file is checked for changes
+const topicsFilePoll = 2 * time.Second
+
+// topicsFileMsg carries the topic filters read from the topics file
+type topicsFileMsg struct {
+	Topics []string
+	Err    error
+}
+
+// readTopicsFile reads one topic filter per line. Blank lines and lines
+// starting with # are skipped, except a bare # which is the wildcard for
+// every topic.
+func readTopicsFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var topics []string
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || (strings.HasPrefix(line, "#") && line != "#") {
+			continue
+		}
+		if err := validateTopicFilter(line); err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		if !slices.Contains(topics, line) {
+			topics = append(topics, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	sort.Strings(topics)
+	return topics, nil
+}
+
+// readTopicsFileCmd reads the topics file after delay
+func readTopicsFileCmd(path string, delay time.Duration) tea.Cmd {
+	read := func() tea.Msg {
+		topics, err := readTopicsFile(path)
+		return topicsFileMsg{Topics: topics, Err: err}
+	}
+	if delay <= 0 {
+		return read
+	}
+	return tea.Tick(delay, func(time.Time) tea.Msg { return read() })
+}
+
+// syncTopicsFile subscribes to the filters added to the topics file and
+// unsubscribes from the ones removed since it was last read. Changes wait
+// while disconnected, as the file is read again on the next poll.
+func (a *App) syncTopicsFile(msg topicsFileMsg) []tea.Cmd {
+	cmds := []tea.Cmd{readTopicsFileCmd(a.config.TopicsFile, topicsFilePoll)}
+	if msg.Err != nil {
+		if text := fmt.Sprintf("Topics file: %v", msg.Err); text != a.topicsFileErr {
+			a.topicsFileErr = text
+			a.ui.SetError(text)
+		}
+		return cmds
+	}
+	a.topicsFileErr = ""
+	if a.mqtt == nil || !a.mqtt.IsConnected() || slices.Equal(msg.Topics, a.fileTopics) {
+		return cmds
+	}
+
+	oldSubscribed := a.ui.GetSubscribedTopics()
+	for _, topic := range a.fileTopics {
+		if !slices.Contains(msg.Topics, topic) {
+			a.ui.removeExplicitSubscription(topic)
+		}
+	}
+	for _, topic := range msg.Topics {
+		a.ui.addExplicitSubscription(topic)
+	}
+	a.fileTopics = msg.Topics
+	return append(cmds, a.handleSubscriptionChanges(oldSubscribed, a.ui.GetSubscribedTopics())...)
+}
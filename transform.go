@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const (
+	// transformTimeout bounds how long an external decoder may run
+	transformTimeout = 2 * time.Second
+	// maxConcurrentTransforms bounds how many decoders run at once; messages
+	// arriving while all slots are busy are shown undecoded
+	maxConcurrentTransforms = 4
+	// maxTransformOutput caps how much decoder output is kept
+	maxTransformOutput = 64 * 1024
+)
+
+// PayloadTransform pipes payloads of topics matching Filter through Command
+type PayloadTransform struct {
+	Filter  string
+	Command string
+}
+
+// TransformResultMsg carries the output of an external decoder for a message
+type TransformResultMsg struct {
+	Seq    uint64
+	Output string
+	Err    error
+}
+
+// parseTransforms parses "filter=command" entries separated by semicolons,
+// e.g. "plc/+/raw=plcdecode --json;sensors/#=./decode.sh"
+func parseTransforms(spec string) ([]PayloadTransform, error) {
+	var transforms []PayloadTransform
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		filter, command, ok := strings.Cut(entry, "=")
+		filter, command = strings.TrimSpace(filter), strings.TrimSpace(command)
+		if !ok || filter == "" || command == "" {
+			return nil, fmt.Errorf("invalid transform %q, expected filter=command", entry)
+		}
+		transforms = append(transforms, PayloadTransform{Filter: filter, Command: command})
+	}
+	return transforms, nil
+}
+
+// Transformer runs external decoder commands for matching messages
+type Transformer struct {
+	transforms []PayloadTransform
+	slots      chan struct{}
+}
+
+// NewTransformer creates a transformer for the given transforms
+func NewTransformer(transforms []PayloadTransform) *Transformer {
+	return &Transformer{
+		transforms: transforms,
+		slots:      make(chan struct{}, maxConcurrentTransforms),
+	}
+}
+
+// Cmd returns a command decoding the message with the first matching
+// transform, or nil when no transform applies
+func (t *Transformer) Cmd(msg Message) tea.Cmd {
+	for _, transform := range t.transforms {
+		if topicMatches(transform.Filter, msg.Topic) {
+			return t.run(transform.Command, msg)
+		}
+	}
+	return nil
+}
+
+// run executes a decoder with the payload on stdin and captures its stdout
+func (t *Transformer) run(command string, msg Message) tea.Cmd {
+	return func() tea.Msg {
+		// Don't let a slow decoder pile up processes under a message flood
+		select {
+		case t.slots <- struct{}{}:
+			defer func() { <-t.slots }()
+		default:
+			return TransformResultMsg{Seq: msg.Seq, Err: fmt.Errorf("decoders busy")}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), transformTimeout)
+		defer cancel()
+
+		cmd := exec.CommandContext(ctx, "sh", "-c", command)
+		cmd.Stdin = bytes.NewReader(payloadBytes(msg))
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+
+		if err := cmd.Run(); err != nil {
+			if ctx.Err() == context.DeadlineExceeded {
+				err = fmt.Errorf("timed out after %v", transformTimeout)
+			} else if detail := strings.TrimSpace(stderr.String()); detail != "" {
+				err = fmt.Errorf("%v: %s", err, detail)
+			}
+			return TransformResultMsg{Seq: msg.Seq, Err: err}
+		}
+
+		output := stdout.Bytes()
+		if len(output) > maxTransformOutput {
+			output = output[:maxTransformOutput]
+		}
+		return TransformResultMsg{Seq: msg.Seq, Output: strings.TrimRight(string(output), "\n")}
+	}
+}
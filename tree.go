@@ -0,0 +1,284 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// topicNode is one level of the topic hierarchy; Path is the topic up to and
+// including this level
+type topicNode struct {
+	Name     string
+	Path     string
+	IsTopic  bool
+	Children []*topicNode
+	// byName indexes Children while the tree is built
+	byName map[string]*topicNode
+}
+
+// topicRow is a line of the tree view
+type topicRow struct {
+	Path     string
+	Name     string
+	Depth    int
+	Branch   bool
+	Expanded bool
+	Topics   int
+	// Messages is the message count of every listed topic under a branch
+	Messages int
+}
+
+// buildTopicTree splits topics on "/" into a tree whose levels are sorted by name
+func buildTopicTree(topics []string) *topicNode {
+	root := &topicNode{}
+	for _, topic := range topics {
+		node := root
+		for i, level := range strings.Split(topic, "/") {
+			child := node.child(level)
+			if child == nil {
+				path := level
+				if i > 0 {
+					path = node.Path + "/" + level
+				}
+				child = &topicNode{Name: level, Path: path}
+				node.Children = append(node.Children, child)
+				if node.byName == nil {
+					node.byName = make(map[string]*topicNode)
+				}
+				node.byName[level] = child
+			}
+			node = child
+		}
+		node.IsTopic = true
+	}
+	root.sortChildren()
+	return root
+}
+
+// child returns the child node with the given name, or nil
+func (n *topicNode) child(name string) *topicNode {
+	return n.byName[name]
+}
+
+// sortChildren sorts every level of the tree by name
+func (n *topicNode) sortChildren() {
+	sort.Slice(n.Children, func(i, j int) bool { return n.Children[i].Name < n.Children[j].Name })
+	for _, child := range n.Children {
+		child.sortChildren()
+	}
+}
+
+// tree returns the topic tree, rebuilt from the topics if they changed
+// since it was last asked for. Only the tree view asks, so discovering
+// topics with the flat list doesn't pay for building it.
+func (ui *UI) tree() *topicNode {
+	if ui.treeStale {
+		ui.topicTree = buildTopicTree(ui.topics)
+		ui.treeStale = false
+	}
+	return ui.topicTree
+}
+
+// treeActive reports whether the topics pane shows the tree; the
+// subscriptions view always stays flat
+func (ui *UI) treeActive() bool {
+	return ui.treeView && !ui.showSubscribed
+}
+
+// topicRows flattens the expanded part of the topic tree into rows. While
+// the topic filter is set, only branches leading to matching topics are
+// listed and they are shown expanded.
+func (ui *UI) topicRows() []topicRow {
+	var rows []topicRow
+	for _, child := range ui.tree().Children {
+		rows, _ = ui.appendTopicRows(rows, child, 0)
+	}
+	return rows
+}
+
+// appendTopicRows appends the rows of a node and its visible descendants,
+// returning the node's row with the matching topics it covers and their
+// messages rolled up
+func (ui *UI) appendTopicRows(rows []topicRow, node *topicNode, depth int) ([]topicRow, topicRow) {
+	row := topicRow{
+		Path:     node.Path,
+		Name:     node.Name,
+		Depth:    depth,
+		Branch:   len(node.Children) > 0,
+		Expanded: ui.expandedNodes[node.Path] || ui.filter != "",
+	}
+	at := len(rows)
+	rows = append(rows, row)
+
+	if node.IsTopic && len(ui.filterTopics([]string{node.Path})) > 0 {
+		row.Topics++
+		if stats, ok := ui.topicStats[node.Path]; ok {
+			row.Messages += stats.Count
+		}
+	}
+	for _, child := range node.Children {
+		var childRow topicRow
+		rows, childRow = ui.appendTopicRows(rows, child, depth+1)
+		row.Topics += childRow.Topics
+		row.Messages += childRow.Messages
+	}
+
+	if row.Topics == 0 {
+		return rows[:at], row
+	}
+	if !row.Expanded {
+		rows = rows[:at+1]
+	}
+	rows[at] = row
+	return rows, row
+}
+
+// topicKeys returns what each line of the topics pane stands for: topics in
+// the flat view, node paths in the tree view
+func (ui *UI) topicKeys() []string {
+	if !ui.treeActive() {
+		return ui.listedTopics()
+	}
+	rows := ui.topicRows()
+	keys := make([]string, len(rows))
+	for i, row := range rows {
+		keys[i] = row.Path
+	}
+	return keys
+}
+
+// selectedTopicRow returns the selected line of the tree view
+func (ui *UI) selectedTopicRow() (topicRow, bool) {
+	rows := ui.topicRows()
+	if ui.selectedTopic < 0 || ui.selectedTopic >= len(rows) {
+		return topicRow{}, false
+	}
+	return rows[ui.selectedTopic], true
+}
+
+// selectedTopicName returns the topic selected in the topics pane; a branch
+// of the tree view is not a topic
+func (ui *UI) selectedTopicName() (string, bool) {
+	if ui.treeActive() {
+		row, ok := ui.selectedTopicRow()
+		if !ok || row.Branch {
+			return "", false
+		}
+		return row.Path, true
+	}
+	topics := ui.listedTopics()
+	if ui.selectedTopic < 0 || ui.selectedTopic >= len(topics) {
+		return "", false
+	}
+	return topics[ui.selectedTopic], true
+}
+
+// selectedSubscription returns the subscription the selected line toggles:
+// the topic itself, or branch/# for a branch of the tree view
+func (ui *UI) selectedSubscription() (string, bool) {
+	if ui.treeActive() {
+		if row, ok := ui.selectedTopicRow(); ok && row.Branch {
+			return row.Path + "/#", true
+		}
+	}
+	return ui.selectedTopicName()
+}
+
+// setNodeExpanded expands or collapses the selected branch; collapsing a
+// leaf moves the selection to its parent
+func (ui *UI) setNodeExpanded(expanded bool) {
+	row, ok := ui.selectedTopicRow()
+	if !ok {
+		return
+	}
+	if row.Branch && row.Expanded != expanded {
+		ui.expandedNodes[row.Path] = expanded
+		return
+	}
+	if !expanded && row.Depth > 0 {
+		rows := ui.topicRows()
+		for i := ui.selectedTopic - 1; i >= 0; i-- {
+			if rows[i].Depth < row.Depth {
+				ui.selectedTopic = i
+				return
+			}
+		}
+	}
+}
+
+// treeLabel returns a tree row's topic, its indented label and the
+// subscription it toggles
+func (ui *UI) treeLabel(row topicRow) (topic, label, subscription string) {
+	marker := "  "
+	subscription = row.Path
+	if row.Branch {
+		marker = "▸ "
+		if row.Expanded {
+			marker = "▾ "
+		}
+		subscription = row.Path + "/#"
+	}
+	name := row.Name
+	if name == "" {
+		name = "(empty)"
+	}
+	return row.Path, strings.Repeat("  ", row.Depth) + marker + name, subscription
+}
+
+// toggleBranchWildcard subscribes to everything under the selected topic
+// with a /# filter. Pressing it again widens the filter a level, so
+// home/kitchen/temp/# becomes home/kitchen/#, and at the top level
+// unsubscribes. Only filters made this way are widened or dropped.
+func (ui *UI) toggleBranchWildcard() tea.Cmd {
+	base, ok := ui.selectedSubscription()
+	if !ok {
+		return nil
+	}
+	base = strings.TrimSuffix(base, "/#")
+
+	// The deepest branch filter already covering the selection is widened
+	current := ""
+	for filter := range ui.branchFilters {
+		prefix := strings.TrimSuffix(filter, "/#")
+		if ui.subscribedTopics[filter] && (base == prefix || strings.HasPrefix(base, prefix+"/")) && len(filter) > len(current) {
+			current = filter
+		}
+	}
+	next := base + "/#"
+	if current != "" {
+		prefix := strings.TrimSuffix(current, "/#")
+		i := strings.LastIndex(prefix, "/")
+		if i < 0 {
+			ui.removeExplicitSubscription(current)
+			return ui.FlashNotice("Unsubscribed from " + current)
+		}
+		next = prefix[:i] + "/#"
+	} else if ui.subscribedTopics[next] {
+		return ui.FlashNotice("Already subscribed to " + next)
+	}
+	if err := validateTopicFilter(next); err != nil {
+		ui.SetError(fmt.Sprintf("Invalid filter: %v", err))
+		return nil
+	}
+
+	if current != "" {
+		ui.removeExplicitSubscription(current)
+	}
+	ui.addExplicitSubscription(next)
+	ui.branchFilters[next] = true
+	return ui.FlashNotice(fmt.Sprintf("Subscribed to %s (w again widens it)", next))
+}
+
+// coveredByWildcard reports whether a topic receives messages through a
+// subscribed wildcard filter other than itself
+func (ui *UI) coveredByWildcard(topic string) bool {
+	for filter, subscribed := range ui.subscribedTopics {
+		if subscribed && filter != topic && strings.ContainsAny(filter, "+#") && topicMatches(filter, topic) {
+			return true
+		}
+	}
+	return false
+}
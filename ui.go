@@ -2,27 +2,136 @@ package main
 
 import (
 	"fmt"
+	"regexp"
+	"slices"
 	"sort"
 	"strings"
 	"time"
 
+	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/mattn/go-runewidth"
 )
 
 // UI represents the user interface state
 type UI struct {
 	topics           []string
+	explicitFilters  []string
+	branchFilters    map[string]bool
+	filter           string
+	filterRegexp     *regexp.Regexp
+	search           string
+	searchRe         *regexp.Regexp
+	searchCase       bool
+	searchIndex      int
+	searchHits       []int
+	searchCached     bool
+	treeView         bool
+	topicTree        *topicNode
+	treeStale        bool
+	expandedNodes    map[string]bool
 	selectedTopic    int
 	topicScroll      int
 	subscribedTopics map[string]bool
+	topicStats       map[string]*TopicStats
+	showSubscribed   bool
+	showPreview      bool
+	showStats        bool
+	sparklines       bool
+	statsTickID      int
+	throughput       throughputWindow
+	columnar         bool
+	decoder          PayloadDecoder
+	prettyJSON       bool
+	maxPayloadLines  int
+	maxPayloadBytes  int
+	threaded         bool
+	expandedThreads  map[string]bool
+	selectedThread   string
+	threadScroll     int
+	inspectedTopic   string
+	inspectedMessage uint64
+	diffMode         bool
+	diffCache        *payloadDiffCache
+	showBadges       bool
+	inspectorScroll  int
+	chartTopic       string
+	compareTopics    []string
+	compareScroll    int
 	messages         []Message
+	maxMessages      int
+	messageTTL       time.Duration
+	discovers        bool
+	dropped          int
+	paused           bool
+	pauseSeq         uint64
 	messageScroll    int
+	selectedMessage  int
+	newBelow         int
+	nextSeq          uint64
+	bookmarks        map[uint64]string
+	showBookmarks    bool
+	showErrors       bool
+	errorLog         []ErrorEntry
+	errorID          int
+	errorExpiry      bool
+	selectedBookmark int
+	input            textinput.Model
+	inputMode        InputMode
+	publishTopic     string
+	republish        Message
+	retainRepublish  bool
+	exportFile       string
+	subscribeQoS     byte
 	width            int
 	height           int
 	activePane       Pane
 	error            string
+	notice           string
+	noticeID         int
+	broker           string
+	brokerURL        string
+	clientID         string
+	connStatus       ConnectionStatus
+	connectedAt      time.Time
+	reconnectAttempt int
 	styles           Styles
+	minimal          bool
+	pauseOnBlur      bool
+	noColor          bool
+	mouse            bool
+	blurred          bool
+	lastView         string
+	messageLines     []int
+	pendingKey       string
+	activityWindow   time.Duration
+	watch            *regexp.Regexp
+	watchExpr        string
+	lastBell         time.Time
+	bellPending      bool
+	bellRinging      bool
+	resetConfirm     bool
+	resetTopicScope  bool
+	confirmingReset  bool
+	confirmingQuit   bool
+	showHelp         bool
+	helpScroll       int
+	autoSubscribe    bool
+	autoSubscribeMax int
+	autoSubscribed   int
+	jsonPath         []string
+	pipeline         *DecodePipeline
+	pendingSubscribe []string
+	pendingPublish   *PublishRequestMsg
+	timeLayout       string
+	timeZone         *time.Location
+	fieldFilter      *FieldFilter
+	retainedOnly     bool
+	filterMatches    map[uint64]bool
+	pipelineCache    pipelineCache
+	topicColorRules  []TopicColorRule
+	topicColors      map[string]lipgloss.Color
 }
 
 // Pane represents which pane is currently active
@@ -33,11 +142,84 @@ const (
 	MessagesPane
 )
 
+// ConnectionStatus is the broker connection state shown in the title bar;
+// replays and offline sessions have none
+type ConnectionStatus int
+
+const (
+	StatusNone ConnectionStatus = iota
+	StatusConnecting
+	StatusConnected
+	StatusReconnecting
+	StatusDisconnected
+	StatusOffline
+	StatusStalled
+)
+
+// String names the state for the status bar
+func (s ConnectionStatus) String() string {
+	switch s {
+	case StatusConnecting:
+		return "connecting"
+	case StatusConnected:
+		return "connected"
+	case StatusReconnecting:
+		return "reconnecting"
+	case StatusDisconnected:
+		return "disconnected"
+	case StatusOffline:
+		return "offline"
+	case StatusStalled:
+		return "stalled"
+	}
+	return "no broker"
+}
+
 // Message represents an MQTT message
 type Message struct {
+	Seq       uint64
 	Topic     string
 	Payload   string
+	QoS       byte
 	Timestamp time.Time
+
+	// Raw holds the payload bytes exactly as received; Payload is the same
+	// bytes as text, which may include NULs and invalid UTF-8
+	Raw []byte
+
+	// Queued marks a message the broker held during a disconnect
+	Queued bool
+
+	// Retained marks the broker's stored message for a topic
+	Retained bool
+
+	// Properties holds the MQTT 5 properties sent with the message
+	Properties *MessageProperties
+
+	// Watched marks a message that matched the watch expression on arrival
+	Watched bool
+
+	// Decoded holds the output of an external transform, shown instead of
+	// the raw payload; DecodeErr explains why a transform failed
+	Decoded   string
+	DecodeErr string
+}
+
+// TopicStats holds per-topic message statistics
+type TopicStats struct {
+	Count       int
+	LastSeen    time.Time
+	LastPayload string
+
+	// LastActivity is when the last message arrived, which for queued or
+	// replayed messages is later than their timestamp
+	LastActivity time.Time
+
+	// rate counts arrivals for the messages-per-second rate
+	rate rateCounter
+
+	// values keeps the recent numeric payloads for the inspector's trend
+	values valueRing
 }
 
 // Styles holds all the styling for the UI
@@ -46,64 +228,117 @@ type Styles struct {
 	Title          lipgloss.Style
 	SelectedItem   lipgloss.Style
 	UnselectedItem lipgloss.Style
+	SubscribedItem lipgloss.Style
+	ActiveItem     lipgloss.Style
 	Message        lipgloss.Style
 	MessageTopic   lipgloss.Style
 	MessageTime    lipgloss.Style
 	Error          lipgloss.Style
+	Notice         lipgloss.Style
 	Help           lipgloss.Style
+	Watch          lipgloss.Style
+	Match          lipgloss.Style
 	ActivePane     lipgloss.Style
 	InactivePane   lipgloss.Style
 }
 
 // NewUI creates a new UI instance
-func NewUI() *UI {
-	styles := Styles{
-		Border: lipgloss.NewStyle().
-			Border(lipgloss.RoundedBorder()).
-			BorderForeground(lipgloss.Color("240")),
-		Title: lipgloss.NewStyle().
-			Foreground(lipgloss.Color("205")).
-			Bold(true).
-			Padding(0, 1),
-		SelectedItem: lipgloss.NewStyle().
-			Foreground(lipgloss.Color("170")).
-			Background(lipgloss.Color("57")).
-			Bold(true),
-		UnselectedItem: lipgloss.NewStyle().
-			Foreground(lipgloss.Color("241")),
-		Message: lipgloss.NewStyle().
-			Padding(0, 1).
-			Margin(0, 0, 1, 0),
-		MessageTopic: lipgloss.NewStyle().
-			Foreground(lipgloss.Color("205")).
-			Bold(true),
-		MessageTime: lipgloss.NewStyle().
-			Foreground(lipgloss.Color("241")),
-		Error: lipgloss.NewStyle().
-			Foreground(lipgloss.Color("196")).
-			Bold(true),
-		Help: lipgloss.NewStyle().
-			Foreground(lipgloss.Color("241")).
-			Italic(true),
-		ActivePane: lipgloss.NewStyle().
-			Border(lipgloss.RoundedBorder()).
-			BorderForeground(lipgloss.Color("205")),
-		InactivePane: lipgloss.NewStyle().
-			Border(lipgloss.RoundedBorder()).
-			BorderForeground(lipgloss.Color("240")),
+func NewUI(config Config) *UI {
+	theme := resolveTheme(config.Theme)
+	styles := themeStyles(theme)
+	if config.Minimal {
+		styles = minimalStyles()
 	}
 
 	return &UI{
 		topics:           []string{},
 		subscribedTopics: make(map[string]bool),
+		topicStats:       make(map[string]*TopicStats),
 		messages:         []Message{},
+		bookmarks:        make(map[uint64]string),
+		input:            newTextInput(),
 		activePane:       TopicsPane,
 		styles:           styles,
+		minimal:          config.Minimal,
+		noColor:          config.Minimal || theme.colorless(),
+		pauseOnBlur:      config.PauseOnBlur,
+		mouse:            config.Mouse,
+		brokerURL:        config.BrokerURL,
+		jsonPath:         parseJSONPath(config.JSONPath),
+		sparklines:       config.Sparklines,
+		pipeline:         config.Pipeline,
+		autoSubscribe:    config.AutoSubscribe,
+		showBadges:       config.MessageBadges,
+		autoSubscribeMax: config.AutoSubscribeMax,
+		clientID:         config.ClientID,
+		showPreview:      config.TopicPreview,
+		resetConfirm:     config.ResetConfirm,
+		resetTopicScope:  config.ResetScope == "topic",
+		timeLayout:       resolveTimeFormat(config.TimeFormat, config.TimestampPrecision),
+		timeZone:         resolveTimeZone(config.TimeZone),
+		subscribeQoS:     config.QoS,
+		maxPayloadLines:  config.MaxPayloadLines,
+		maxPayloadBytes:  config.MaxPayloadDisplay,
+		maxMessages:      config.MaxMessages,
+		messageTTL:       config.MessageTTL,
+		discovers:        config.discovers(),
+		exportFile:       config.ExportFile,
+		topicColorRules:  config.TopicColors,
+		topicColors:      make(map[string]lipgloss.Color),
+		filterMatches:    make(map[uint64]bool),
+		expandedThreads:  make(map[string]bool),
+		topicTree:        &topicNode{},
+		expandedNodes:    make(map[string]bool),
+		branchFilters:    make(map[string]bool),
+		watch:            compileWatch(config.Watch),
+		watchExpr:        config.Watch,
+		activityWindow:   config.ActivityWindow,
+	}
+}
+
+// timestampLayout returns the message time layout for a precision of
+// "seconds", "millis" or "micros"; anything else shows milliseconds
+func timestampLayout(precision string) string {
+	switch precision {
+	case "seconds":
+		return "15:04:05"
+	case "micros":
+		return "15:04:05.000000"
+	default:
+		return "15:04:05.000"
+	}
+}
+
+// minimalStyles returns borderless, mostly uncolored styles that keep the
+// escape-sequence traffic per frame low on slow links
+func minimalStyles() Styles {
+	plain := lipgloss.NewStyle()
+	return Styles{
+		Border:         plain,
+		Title:          plain.Bold(true),
+		SelectedItem:   plain.Reverse(true),
+		UnselectedItem: plain,
+		SubscribedItem: plain,
+		ActiveItem:     plain.Bold(true),
+		Message:        plain.Margin(0, 0, 1, 0),
+		MessageTopic:   plain,
+		MessageTime:    plain,
+		Error:          plain,
+		Notice:         plain,
+		Help:           plain,
+		Watch:          plain.Bold(true),
+		Match:          plain.Reverse(true),
+		ActivePane:     plain,
+		InactivePane:   plain,
 	}
 }
 
 // Init implements tea.Model
 func (ui *UI) Init() tea.Cmd {
+	// Relative times age and activity highlights fade between messages
+	if ui.ticking() {
+		return statsTick(ui.statsTickID)
+	}
 	return nil
 }
 
@@ -111,17 +346,114 @@ func (ui *UI) Init() tea.Cmd {
 func (ui *UI) Update(msg tea.Msg) (*UI, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.WindowSizeMsg:
+		// Messages may arrive before the terminal size is known; once it is,
+		// start at the newest ones rather than wherever buffering left us
+		if ui.width == 0 || ui.height == 0 {
+			ui.scrollToLatest()
+		}
 		ui.width = msg.Width
 		ui.height = msg.Height
+	case tea.FocusMsg:
+		ui.blurred = false
+	case tea.BlurMsg:
+		ui.blurred = true
 	case tea.KeyMsg:
 		return ui.handleKeyPress(msg)
+	case tea.MouseMsg:
+		if ui.mouse {
+			return ui.handleMouse(msg)
+		}
+	case clearNoticeMsg:
+		if msg.id == ui.noticeID {
+			ui.notice = ""
+		}
+	case expireErrorMsg:
+		if msg.id == ui.errorID {
+			ui.error = ""
+		}
+	case bellDoneMsg:
+		ui.bellRinging = false
+	case clipboardCopiedMsg:
+		return ui, ui.copiedNotice(msg)
+	case exportDoneMsg:
+		return ui, ui.exportedNotice(msg)
+	case publishFileFailedMsg:
+		ui.SetError(fmt.Sprintf("Cannot publish %s: %v", msg.Path, msg.Err))
+	case statsTickMsg:
+		if ui.ticking() && msg.id == ui.statsTickID {
+			ui.dropExpired(time.Now())
+			return ui, statsTick(msg.id)
+		}
 	}
 	return ui, nil
 }
 
 // handleKeyPress handles keyboard input
 func (ui *UI) handleKeyPress(msg tea.KeyMsg) (*UI, tea.Cmd) {
+	if ui.inputMode != NoInput {
+		return ui.handleInputKey(msg)
+	}
+
+	// The help overlay keeps the keys until ? or esc closes it
+	if ui.showHelp {
+		switch msg.String() {
+		case "?", "esc":
+			ui.showHelp = false
+		case "up", "k":
+			ui.helpScroll = max(ui.helpScroll-1, 0)
+		case "down", "j":
+			ui.helpScroll++
+		}
+		return ui, nil
+	}
+
+	// A pending reset confirmation takes the next key: y confirms, anything else cancels
+	if ui.confirmingReset {
+		ui.confirmingReset = false
+		if msg.String() == "y" {
+			ui.resetMessages()
+		}
+		return ui, nil
+	}
+	if ui.pendingSubscribe != nil {
+		if msg.String() == "y" {
+			ui.subscribeTopics(ui.pendingSubscribe)
+		}
+		ui.pendingSubscribe = nil
+		return ui, nil
+	}
+	if ui.pendingPublish != nil {
+		return ui, ui.confirmPublish(msg.String())
+	}
+
+	// g waits for a second g to jump to the top; any other key drops it
+	if ui.pendingKey == "g" {
+		ui.pendingKey = ""
+		if msg.String() == "g" {
+			ui.jumpToTop()
+			return ui, nil
+		}
+	}
+
 	switch msg.String() {
+	case "?":
+		ui.showHelp = true
+		ui.helpScroll = 0
+	case "g":
+		ui.pendingKey = "g"
+	case "ctrl+d", "ctrl+u", "ctrl+f", "ctrl+b":
+		// Half and full pages, vim style
+		rows := ui.pageSize()
+		if msg.String() == "ctrl+d" || msg.String() == "ctrl+u" {
+			rows = max(rows/2, 1)
+		}
+		key := tea.KeyMsg{Type: tea.KeyDown}
+		if msg.String() == "ctrl+u" || msg.String() == "ctrl+b" {
+			key = tea.KeyMsg{Type: tea.KeyUp}
+		}
+		for range rows {
+			ui.handleKeyPress(key)
+		}
 	case "tab":
 		// Switch between panes
 		if ui.activePane == TopicsPane {
@@ -129,81 +461,446 @@ func (ui *UI) handleKeyPress(msg tea.KeyMsg) (*UI, tea.Cmd) {
 		} else {
 			ui.activePane = TopicsPane
 		}
+	case "v":
+		// Toggle between all discovered topics and active subscriptions
+		ui.showSubscribed = !ui.showSubscribed
+		ui.activePane = TopicsPane
+		ui.selectedTopic = 0
+		ui.topicScroll = 0
 	case "up", "k":
 		if ui.activePane == TopicsPane {
 			if ui.selectedTopic > 0 {
 				ui.selectedTopic--
 			}
-		} else {
-			if ui.messageScroll > 0 {
-				ui.messageScroll--
+		} else if ui.inspectedTopic != "" || ui.inspectedMessage != 0 {
+			if ui.inspectorScroll > 0 {
+				ui.inspectorScroll--
+			}
+		} else if ui.showBookmarks {
+			if ui.selectedBookmark > 0 {
+				ui.selectedBookmark--
 			}
+		} else if ui.comparing() {
+			// Clamped to the content when rendering
+			ui.compareScroll++
+		} else if ui.threaded {
+			ui.moveThreadSelection(-1)
+		} else if i := ui.nextVisibleMessage(ui.selectedMessage, -1); i >= 0 {
+			ui.selectedMessage = i
 		}
 	case "down", "j":
 		if ui.activePane == TopicsPane {
-			if ui.selectedTopic < len(ui.topics)-1 {
+			if ui.selectedTopic < len(ui.topicKeys())-1 {
 				ui.selectedTopic++
 			}
-		} else {
-			if ui.messageScroll < len(ui.messages)-1 {
-				ui.messageScroll++
+		} else if ui.inspectedTopic != "" || ui.inspectedMessage != 0 {
+			// Clamped to the content when rendering
+			ui.inspectorScroll++
+		} else if ui.showBookmarks {
+			if ui.selectedBookmark < len(ui.bookmarks)-1 {
+				ui.selectedBookmark++
+			}
+		} else if ui.comparing() {
+			if ui.compareScroll > 0 {
+				ui.compareScroll--
+			}
+		} else if ui.threaded {
+			ui.moveThreadSelection(1)
+		} else if i := ui.nextVisibleMessage(ui.selectedMessage, 1); i >= 0 {
+			ui.selectedMessage = i
+			if ui.atLatest() {
+				ui.newBelow = 0
 			}
 		}
+	case "G":
+		// Jump to the last topic or the newest message
+		if ui.activePane == TopicsPane {
+			ui.selectedTopic = max(len(ui.topicKeys())-1, 0)
+		} else {
+			ui.scrollToLatest()
+		}
+	case "right", "left":
+		// Expand or collapse the selected branch of the topic tree
+		if ui.activePane == TopicsPane && ui.treeActive() {
+			ui.setNodeExpanded(msg.String() == "right")
+		}
 	case "enter", " ":
-		if ui.activePane == TopicsPane && len(ui.topics) > 0 {
-			topic := ui.topics[ui.selectedTopic]
+		if topic, ok := ui.selectedSubscription(); ok && ui.activePane == TopicsPane {
 			ui.subscribedTopics[topic] = !ui.subscribedTopics[topic]
+		} else if ui.activePane == MessagesPane && ui.showBookmarks {
+			ui.openSelectedBookmark()
+		} else if ui.activePane == MessagesPane && ui.threaded {
+			ui.toggleSelectedThread()
+		} else if seq, ok := ui.selectedMessageSeq(); ok && ui.activePane == MessagesPane && ui.inspectedMessage == 0 {
+			// Open the selected message in the message inspector
+			ui.inspectedMessage = seq
+			ui.inspectorScroll = 0
+		}
+	case "y":
+		// Copy the selected message's payload
+		if ui.activePane == MessagesPane {
+			return ui, ui.copySelectedPayload()
+		}
+	case "W":
+		// Set the expression that flags matching messages and rings the bell
+		return ui, ui.startInput(WatchInput, watchPrompt, ui.watchExpr)
+	case "w":
+		// Subscribe to the selected topic's branch, widening on repeats
+		if ui.activePane == TopicsPane {
+			return ui, ui.toggleBranchWildcard()
+		}
+	case "s":
+		// Subscribe to a typed topic filter, wildcards included
+		return ui, ui.startInput(SubscribeInput, subscribePrompt, "")
+	case "e":
+		// Export the messages passing the filters; .csv files get CSV
+		return ui, ui.startInput(ExportInput, "Export to: ", ui.exportFile)
+	case "b":
+		// Bookmark the selected message
+		if ui.activePane == MessagesPane {
+			ui.toggleBookmark()
+		}
+	case "a":
+		// Annotate the selected message with a bookmark note
+		if seq, ok := ui.selectedMessageSeq(); ok && ui.activePane == MessagesPane {
+			return ui, ui.startInput(BookmarkNoteInput, "Note: ", ui.bookmarks[seq])
+		}
+	case "B":
+		// Toggle the bookmarks list
+		ui.showBookmarks = !ui.showBookmarks
+		ui.inspectedTopic = ""
+		ui.inspectedMessage = 0
+		ui.chartTopic = ""
+		ui.activePane = MessagesPane
+	case "Q":
+		// Cycle the QoS requested by new subscriptions
+		ui.subscribeQoS = (ui.subscribeQoS + 1) % 3
+		return ui, ui.FlashNotice(fmt.Sprintf("New subscriptions use QoS %d", ui.subscribeQoS))
+	case "p":
+		// Compose a message to publish on the selected topic
+		if topic, ok := ui.selectedTopicName(); ok {
+			if err := validateTopicName(topic); err != nil {
+				ui.SetError(fmt.Sprintf("Invalid topic: %v", err))
+				break
+			}
+			ui.publishTopic = topic
+			return ui, ui.startInput(PublishInput, fmt.Sprintf("Publish to %s: ", ui.publishTopic), "")
+		}
+		ui.SetError("Select a topic to publish to")
+	case "R":
+		// Publish the selected message again, to its topic or another one
+		if i := ui.selectedMessage; ui.activePane == MessagesPane && i >= 0 && i < len(ui.messages) {
+			ui.republish = ui.messages[i]
+			ui.retainRepublish = ui.republish.Retained
+			return ui, ui.startInput(RepublishInput, ui.republishPrompt(), ui.republish.Topic)
+		}
+	case "A":
+		// Subscribe to every listed topic, asking first when there are many
+		ui.subscribeAll()
+	case "U":
+		// Unsubscribe from everything
+		for topic := range ui.subscribedTopics {
+			ui.subscribedTopics[topic] = false
+		}
+	case "P":
+		// Freeze the messages pane; new messages are buffered and shown on resume
+		ui.togglePause()
+	case "H":
+		// Show only retained messages, the state the broker holds
+		ui.retainedOnly = !ui.retainedOnly
+		ui.invalidateSearch()
+		ui.scrollToLatest()
+	case "F":
+		// Filter messages by a JSON field expression; an empty one clears it
+		expr := ""
+		if ui.fieldFilter != nil {
+			expr = ui.fieldFilter.Expr
+		}
+		return ui, ui.startInput(FieldFilterInput, "Filter (field op value): ", expr)
+	case "[":
+		ui.jumpToBookmark(-1)
+	case "]":
+		ui.jumpToBookmark(1)
+	case "o":
+		// Toggle between the flat topic list and the topic tree
+		ui.treeView = !ui.treeView
+		ui.activePane = TopicsPane
+		ui.selectedTopic = 0
+		ui.topicScroll = 0
+	case "C":
+		// Toggle between card and columnar message layouts
+		ui.columnar = !ui.columnar
+	case "T":
+		// Toggle between the flat message stream and per-topic threads
+		ui.threaded = !ui.threaded
+		ui.selectedThread = ""
+		ui.threadScroll = 0
+	case "f":
+		// Toggle pretty-printing JSON payloads
+		ui.prettyJSON = !ui.prettyJSON
+	case "X":
+		// Cycle how payloads are decoded: text, hex dump, base64
+		ui.decoder = ui.decoder.next()
+		return ui, ui.FlashNotice("Payloads shown as " + ui.decoder.String())
+	case "l":
+		// Toggle the latest payload preview next to each topic
+		ui.showPreview = !ui.showPreview
+	case "S":
+		// Toggle each topic's message count and rate; the tick keeps rates
+		// current while no messages arrive
+		ui.showStats = !ui.showStats
+		if ui.showStats {
+			return ui, ui.RestartTick()
+		}
+	case "i":
+		// Open the inspector for the selected topic
+		if topic, ok := ui.selectedTopicName(); ok && ui.activePane == TopicsPane {
+			ui.inspectedTopic = topic
+			ui.inspectedMessage = 0
+			ui.inspectorScroll = 0
+			ui.chartTopic = ""
+			ui.activePane = MessagesPane
+		}
+	case "d":
+		// Remove the selected stale topic from the list, or in the message
+		// inspector toggle the diff against the topic's previous message
+		if topic, ok := ui.selectedTopicName(); ok && ui.activePane == TopicsPane {
+			return ui, ui.removeTopic(topic)
+		} else if ui.inspectedMessage != 0 && ui.activePane == MessagesPane {
+			ui.diffMode = !ui.diffMode
+			ui.diffCache = nil
+			ui.inspectorScroll = 0
+		}
+	case "D":
+		// Clear every discovered topic; discovery starts over
+		if ui.activePane == TopicsPane {
+			return ui, ui.clearTopics()
+		}
+	case "t":
+		// Chart the selected topic's numeric payloads over time
+		if topic, ok := ui.selectedTopicName(); ok && ui.activePane == TopicsPane {
+			ui.chartTopic = topic
+			ui.inspectedTopic = ""
+			ui.inspectedMessage = 0
+			ui.showBookmarks = false
+			ui.activePane = MessagesPane
+		}
+	case "=":
+		// Pin the selected topic for the side-by-side compare view
+		if ui.activePane == TopicsPane {
+			ui.toggleCompareTopic()
+		}
+	case "/":
+		// Search payloads from the messages pane, otherwise filter the
+		// topics pane, as you type
+		if ui.activePane == MessagesPane {
+			return ui, ui.startInput(SearchInput, "Search: ", ui.search)
+		}
+		return ui, ui.startInput(TopicFilterInput, "/", ui.filter)
+	case "n", "N":
+		// Jump to the next or previous message matching the search
+		if msg.String() == "n" {
+			ui.jumpToMatch(1)
+		} else {
+			ui.jumpToMatch(-1)
+		}
+	case "I":
+		// Toggle case-sensitive search
+		if ui.search != "" {
+			ui.toggleSearchCase()
+		}
+	case "esc":
+		// The message inspector closes on its own, back to the split view
+		if ui.inspectedMessage != 0 {
+			ui.inspectedMessage = 0
+			ui.diffMode = false
+			ui.diffCache = nil
+			return ui, nil
+		}
+		if ui.filter != "" {
+			ui.setTopicFilter("")
+		}
+		ui.setSearch("")
+		ui.inspectedTopic = ""
+		ui.showBookmarks = false
+		ui.showErrors = false
+		ui.chartTopic = ""
+		ui.compareTopics = nil
+	case "m":
+		// Toggle the QoS and retained badges on messages
+		ui.showBadges = !ui.showBadges
+	case "M":
+		// Toggle subscribing to topics as they are discovered
+		return ui, ui.toggleAutoSubscribe()
+	case "x":
+		// Dismiss the error line; E still lists it
+		ui.error = ""
+	case "E":
+		// Toggle the recent errors list
+		ui.showErrors = !ui.showErrors
+		if ui.showErrors {
+			ui.activePane = MessagesPane
 		}
 	case "r":
-		// Reset messages
+		// Reset messages, asking first unless confirmation is disabled
+		if ui.resetConfirm {
+			ui.confirmingReset = true
+		} else {
+			ui.resetMessages()
+		}
+	}
+	return ui, nil
+}
+
+// resetTarget returns the topic a reset is scoped to, or "" to clear everything
+func (ui *UI) resetTarget() string {
+	if !ui.resetTopicScope {
+		return ""
+	}
+	if ui.inspectedTopic != "" {
+		return ui.inspectedTopic
+	}
+	topic, _ := ui.selectedTopicName()
+	return topic
+}
+
+// resetMessages clears the message buffer, or only the selected topic's
+// messages when resets are scoped to a topic
+func (ui *UI) resetMessages() {
+	topic := ui.resetTarget()
+	ui.newBelow = 0
+	if topic == "" {
 		ui.messages = []Message{}
+		ui.dropped = 0
 		ui.messageScroll = 0
+		ui.selectedMessage = 0
+		ui.filterMatches = make(map[uint64]bool)
+		clear(ui.pipelineCache.results)
+		ui.invalidateSearch()
+		ui.pruneBookmarks()
+		return
 	}
-	return ui, nil
+
+	kept := ui.messages[:0]
+	for _, msg := range ui.messages {
+		if msg.Topic != topic {
+			kept = append(kept, msg)
+		} else {
+			delete(ui.pipelineCache.results, msg.Seq)
+		}
+	}
+	ui.messages = kept
+	ui.invalidateSearch()
+	if ui.selectedMessage >= len(ui.messages) {
+		ui.selectedMessage = len(ui.messages) - 1
+	}
+	if ui.selectedMessage < 0 {
+		ui.selectedMessage = 0
+	}
+	ui.pruneBookmarks()
 }
 
 // View implements tea.Model
 func (ui *UI) View() string {
+	view := ui.render()
+	if ui.bellRinging {
+		view += "\a"
+	}
+	return view
+}
+
+// render draws the interface for View
+func (ui *UI) render() string {
 	if ui.width == 0 || ui.height == 0 {
 		return "Initializing interface..."
 	}
 
-	// Calculate dimensions for better layout
-	totalWidth := ui.width
-	totalHeight := ui.height
-
-	// Reserve space for title and help
-	availableHeight := totalHeight - 4
-	if availableHeight < 10 {
-		availableHeight = 10
+	// Below the minimum the panes would overflow and overlap; keys still work
+	if ui.tooSmall() {
+		return ui.renderTooSmall()
 	}
-
-	// Calculate panel widths (1/3 for topics, 2/3 for messages)
-	topicsWidth := totalWidth / 3
-	if topicsWidth < 20 {
-		topicsWidth = 20
+	if ui.showHelp {
+		return ui.renderHelpOverlay()
 	}
-	messagesWidth := totalWidth - topicsWidth - 2
-	if messagesWidth < 30 {
-		messagesWidth = 30
+
+	// Keep showing the last frame while the terminal is in the background;
+	// messages are still buffered and appear once focus returns
+	if ui.pauseOnBlur && ui.blurred && ui.lastView != "" {
+		return ui.lastView
 	}
 
+	// Calculate dimensions for better layout
+	topicsWidth, messagesWidth, availableHeight := ui.paneLayout()
+
 	// Create the topics view
 	topicsView := ui.renderTopicsPane(topicsWidth, availableHeight)
 
-	// Create the messages view
-	messagesView := ui.renderMessagesPane(messagesWidth, availableHeight)
+	// Create the messages view, or the inspector when a topic is inspected;
+	// only the messages pane records lines for mouse clicks
+	var messagesView string
+	ui.messageLines = ui.messageLines[:0]
+	if ui.inspectedMessage != 0 {
+		messagesView = ui.renderMessageInspector(messagesWidth, availableHeight)
+	} else if ui.inspectedTopic != "" {
+		messagesView = ui.renderTopicInspector(messagesWidth, availableHeight)
+	} else if ui.showErrors {
+		messagesView = ui.renderErrorsPane(messagesWidth, availableHeight)
+	} else if ui.showBookmarks {
+		messagesView = ui.renderBookmarksPane(messagesWidth, availableHeight)
+	} else if ui.chartTopic != "" {
+		messagesView = ui.renderChartPane(messagesWidth, availableHeight)
+	} else if ui.comparing() {
+		messagesView = ui.renderComparePane(messagesWidth, availableHeight)
+	} else if ui.threaded {
+		messagesView = ui.renderThreadsPane(messagesWidth, availableHeight)
+	} else {
+		messagesView = ui.renderMessagesPane(messagesWidth, availableHeight)
+	}
 
 	// Combine the views horizontally
-	content := lipgloss.JoinHorizontal(
-		lipgloss.Top,
-		topicsView,
-		messagesView,
-	)
+	var content string
+	if ui.minimal {
+		// Without borders the panes need a plain divider between them
+		divider := strings.TrimSuffix(strings.Repeat("│\n", availableHeight), "\n")
+		content = lipgloss.JoinHorizontal(
+			lipgloss.Top,
+			topicsView,
+			divider,
+			messagesView,
+		)
+	} else {
+		content = lipgloss.JoinHorizontal(
+			lipgloss.Top,
+			topicsView,
+			messagesView,
+		)
+	}
 
 	// Add title and help
-	title := ui.styles.Title.Render(fmt.Sprintf("MQTT TUI Browser [%dx%d]", ui.width, ui.height))
-	help := ui.renderHelp()
+	titleText := fmt.Sprintf("MQTT TUI Browser [%dx%d]", ui.width, ui.height)
+	switch ui.connStatus {
+	case StatusConnecting:
+		titleText += " • Connecting..."
+	case StatusConnected:
+		titleText += " • [connected] " + ui.broker
+	case StatusReconnecting:
+		titleText += " • [reconnecting…]"
+		if ui.reconnectAttempt > 0 {
+			titleText += fmt.Sprintf(" attempt %d", ui.reconnectAttempt)
+		}
+	case StatusDisconnected:
+		titleText += " • [disconnected] press c to retry"
+	case StatusOffline:
+		titleText += " • [offline] press c to connect"
+	case StatusStalled:
+		titleText += " • [stalled] no answer from " + ui.broker
+	default:
+		if ui.broker != "" {
+			titleText += " • " + ui.broker
+		}
+	}
+	title := ui.styles.Title.Render(titleText)
+	help := lipgloss.JoinVertical(lipgloss.Left, ui.renderStatusBar(), ui.renderHelp())
 
 	// Combine everything vertically
 	var result string
@@ -216,6 +913,14 @@ func (ui *UI) View() string {
 			errorMsg,
 			help,
 		)
+	} else if ui.notice != "" {
+		result = lipgloss.JoinVertical(
+			lipgloss.Left,
+			title,
+			content,
+			ui.styles.Notice.Render(ui.notice),
+			help,
+		)
 	} else {
 		result = lipgloss.JoinVertical(
 			lipgloss.Left,
@@ -225,14 +930,21 @@ func (ui *UI) View() string {
 		)
 	}
 
+	ui.lastView = result
 	return result
 }
 
 // renderTopicsPane renders the topics list pane
 func (ui *UI) renderTopicsPane(width, height int) string {
+	topics := ui.listedTopics()
 	title := "Topics"
-	if len(ui.topics) > 0 {
-		title += fmt.Sprintf(" (%d)", len(ui.topics))
+	if ui.showSubscribed {
+		title = "Subscriptions"
+	}
+	if ui.filter != "" {
+		title += fmt.Sprintf(" (%d/%d)", len(topics), len(ui.unfilteredTopics()))
+	} else if len(topics) > 0 {
+		title += fmt.Sprintf(" (%d)", len(topics))
 	}
 
 	// Calculate available space for topics (minus title and borders)
@@ -242,60 +954,109 @@ func (ui *UI) renderTopicsPane(width, height int) string {
 	}
 
 	var items []string
-	
-	if len(ui.topics) == 0 {
-		items = append(items, ui.styles.UnselectedItem.Render("No topics discovered yet..."))
+
+	if len(topics) == 0 {
+		empty := "No topics discovered yet..."
+		if !ui.discovers {
+			empty = "No messages on the subscribed topics yet..."
+		}
+		if ui.filter != "" {
+			empty = "No topics match " + ui.filter
+		} else if ui.showSubscribed {
+			empty = "No active subscriptions..."
+		}
+		items = append(items, ui.styles.UnselectedItem.Render(empty))
 	} else {
 		// Calculate scroll position to keep selected topic visible
 		ui.updateTopicScroll(availableLines)
-		
+
+		// The tree view lists nodes instead of topics
+		var rows []topicRow
+		lines := len(topics)
+		if ui.treeActive() {
+			rows = ui.topicRows()
+			lines = len(rows)
+		}
+
 		// Render visible topics
 		startIdx := ui.topicScroll
 		endIdx := startIdx + availableLines
-		if endIdx > len(ui.topics) {
-			endIdx = len(ui.topics)
+		if endIdx > lines {
+			endIdx = lines
 		}
 
 		for i := startIdx; i < endIdx; i++ {
-			topic := ui.topics[i]
+			var topic, label, subscription string
+			if rows != nil {
+				topic, label, subscription = ui.treeLabel(rows[i])
+			} else {
+				topic, label, subscription = topics[i], topics[i], topics[i]
+			}
+			// ◦ marks topics a wildcard subscription already receives
 			prefix := "  "
-			if ui.subscribedTopics[topic] {
+			if ui.subscribedTopics[subscription] {
 				prefix = "✓ "
+			} else if ui.coveredByWildcard(subscription) {
+				prefix = "◦ "
+			}
+
+			// Subscriptions show their activity after the topic name
+			suffix := ""
+			if ui.showSubscribed {
+				suffix = ui.subscriptionSummary(topic)
+			} else if ui.showStats && (rows == nil || !rows[i].Branch) {
+				suffix = ui.topicStatsSummary(topic)
+			}
+			if rows != nil && rows[i].Branch {
+				// Branches roll up the messages of every topic under them
+				suffix += fmt.Sprintf("  (%d topics, %d msgs)", rows[i].Topics, rows[i].Messages)
+			} else if ui.branchFilters[topic] {
+				suffix += "  (branch)"
+			} else {
+				suffix = ui.topicSparkline(topic, width) + suffix
+				if ui.showPreview {
+					suffix += ui.payloadPreview(topic, (width-8)/2)
+				}
 			}
 
 			// Truncate long topic names to fit
-			maxTopicLen := width - 8 // Account for prefix, padding, and border
+			maxTopicLen := width - 8 - runewidth.StringWidth(suffix) // Account for prefix, padding, and border
 			if maxTopicLen < 10 {
 				maxTopicLen = 10
 			}
-			displayTopic := topic
-			if len(topic) > maxTopicLen {
-				displayTopic = topic[:maxTopicLen-3] + "..."
-			}
+			displayTopic := runewidth.Truncate(label, maxTopicLen, "...")
 
-			item := prefix + displayTopic
+			item := prefix + displayTopic + suffix
 			if i == ui.selectedTopic && ui.activePane == TopicsPane {
-				item = ui.styles.SelectedItem.Render(item)
+				// Pad to the pane's display width so the highlight is a clean bar
+				item = ui.styles.SelectedItem.Width(width).Render(item)
+			} else if ui.recentlyActive(topic) {
+				item = ui.styles.ActiveItem.Render(item)
+			} else if color, ok := ui.colorForTopic(topic); ok {
+				item = ui.styles.UnselectedItem.Foreground(color).Render(item)
+			} else if ui.subscribedTopics[subscription] {
+				item = ui.styles.SubscribedItem.Render(item)
 			} else {
 				item = ui.styles.UnselectedItem.Render(item)
 			}
 			items = append(items, item)
 		}
-		
+
 		// Add scroll indicators
 		if ui.topicScroll > 0 {
 			title += " ↑"
 		}
-		if endIdx < len(ui.topics) {
+		if endIdx < lines {
 			title += " ↓"
 		}
 	}
 
 	content := strings.Join(items, "\n")
-	
+
 	style := ui.styles.InactivePane
 	if ui.activePane == TopicsPane {
 		style = ui.styles.ActivePane
+		title = ui.activeTitle(title)
 	}
 
 	return style.
@@ -310,24 +1071,67 @@ func (ui *UI) renderTopicsPane(width, height int) string {
 
 // renderMessagesPane renders the messages pane
 func (ui *UI) renderMessagesPane(width, height int) string {
+	visible := ui.visibleMessages()
 	title := "Messages"
-	if len(ui.messages) > 0 {
+	if ui.fieldFilter != nil || ui.retainedOnly {
+		title += fmt.Sprintf(" (%d/%d)", len(visible), len(ui.messages))
+		if ui.retainedOnly {
+			title += " [retained]"
+		}
+		if ui.fieldFilter != nil {
+			title += fmt.Sprintf(" [%s]", ui.fieldFilter.Expr)
+		}
+	} else if len(ui.messages) > 0 {
 		title += fmt.Sprintf(" (%d)", len(ui.messages))
 	}
+	if ui.dropped > 0 {
+		title += fmt.Sprintf(" [%d older dropped]", ui.dropped)
+	}
+	if ui.decoder != TextDecoder {
+		title += fmt.Sprintf(" [%s]", ui.decoder)
+	} else if ui.pipeline != nil {
+		title += fmt.Sprintf(" [%s]", ui.pipeline)
+	}
+	if ui.paused {
+		title += fmt.Sprintf(" [PAUSED +%d]", ui.nextSeq-ui.pauseSeq)
+	}
+	title += ui.searchTitle()
 
 	// Calculate available space for messages
 	availableLines := height - 3
+	if ui.columnar {
+		availableLines-- // Column header
+	}
 	if availableLines < 1 {
 		availableLines = 1
 	}
 
 	var items []string
-	
-	if len(ui.messages) == 0 {
-		items = append(items, ui.styles.UnselectedItem.Render("No messages yet..."))
+
+	if len(visible) == 0 {
+		empty := "No messages yet..."
+		if len(ui.messages) > 0 {
+			empty = "No messages match the filter..."
+		}
+		items = append(items, ui.styles.UnselectedItem.Render(empty))
 	} else {
-		// Ensure scroll position is valid
-		maxScroll := len(ui.messages) - availableLines
+		if ui.columnar {
+			items = append(items, ui.styles.MessageTime.Render("  "+ui.columnHeader(width-4)))
+			ui.recordMessageLines(items[len(items)-1], -1)
+		}
+
+		// Scrolling counts visible messages; keep the selected one in view,
+		// then ensure scroll position is valid
+		selected := sort.SearchInts(visible, ui.selectedMessage)
+		if selected >= len(visible) {
+			selected = len(visible) - 1
+		}
+		if selected < ui.messageScroll {
+			ui.messageScroll = selected
+		} else if selected >= ui.messageScroll+availableLines {
+			ui.messageScroll = selected - availableLines + 1
+		}
+		maxScroll := len(visible) - availableLines
 		if maxScroll < 0 {
 			maxScroll = 0
 		}
@@ -340,23 +1144,88 @@ func (ui *UI) renderMessagesPane(width, height int) string {
 
 		startIdx := ui.messageScroll
 		endIdx := startIdx + availableLines
-		if endIdx > len(ui.messages) {
-			endIdx = len(ui.messages)
+		if endIdx > len(visible) {
+			endIdx = len(visible)
 		}
 
-		for i := startIdx; i < endIdx; i++ {
+		for _, i := range visible[startIdx:endIdx] {
 			msg := ui.messages[i]
-			timeStr := msg.Timestamp.Format("15:04:05")
+			if msg.Queued && (i == 0 || !ui.messages[i-1].Queued) {
+				items = append(items, ui.styles.Help.Render(ui.queuedDivider(i, width-4)))
+				ui.recordMessageLines(items[len(items)-1], -1)
+			}
+			marker := ui.messageMarker(i, msg)
+			if ui.columnar {
+				row := ui.renderMessageRow(msg, width-4)
+				if msg.Watched {
+					row = ui.styles.Watch.Render(row)
+				}
+				items = append(items, marker+row)
+				ui.recordMessageLines(items[len(items)-1], i)
+				continue
+			}
+			timeStr := ui.formatTime(msg.Timestamp)
 
-			topicLine := ui.styles.MessageTopic.Render(msg.Topic) +
+			topicStyle := ui.topicStyle(msg.Topic)
+			if msg.Watched {
+				topicStyle = ui.styles.Watch
+			}
+			topicLine := marker + topicStyle.Render(msg.Topic) +
 				" " + ui.styles.MessageTime.Render(timeStr)
+			if ui.jsonPath != nil {
+				label := strings.Join(ui.jsonPath, ".") + " = "
+				topicLine += " " + ui.styles.ActiveItem.Render(label+ui.jsonPathValue(msg, width/2))
+			}
+			if ui.showBadges {
+				topicLine += " " + ui.styles.Help.Render(fmt.Sprintf("[q%d]", msg.QoS))
+				if msg.Retained {
+					topicLine += " " + ui.styles.Help.Render("[R]")
+				}
+			}
+			if msg.Queued {
+				topicLine += " " + ui.styles.Help.Render("queued")
+			}
+			if note := ui.bookmarks[msg.Seq]; note != "" {
+				topicLine += " " + ui.styles.Help.Render(note)
+			}
 
 			// Wrap payload text to fit width
 			maxPayloadWidth := width - 6 // Account for padding and border
 			if maxPayloadWidth < 20 {
 				maxPayloadWidth = 20
 			}
-			payloadLines := ui.wrapText(msg.Payload, maxPayloadWidth)
+			var payloadLines []string
+			data, binary, note, truncated := ui.previewDecoded(msg)
+			if image, ok := ui.imagePlaceholder(msg); ok {
+				payloadLines = []string{ui.styles.Help.Render(image)}
+				truncated = ""
+			} else if binary {
+				payloadLines = hexDump(data, maxHexDumpLines)
+			} else {
+				payload := string(data)
+				if ui.prettyJSON {
+					payload, _ = prettyJSON(payload)
+				}
+				payloadLines = ui.wrapText(sanitizePayload(payload), maxPayloadWidth)
+				for k, line := range payloadLines {
+					payloadLines[k] = ui.highlightMatches(line)
+				}
+			}
+			// Keep a single huge payload from taking over the pane
+			if ui.maxPayloadLines > 0 && len(payloadLines) > ui.maxPayloadLines {
+				hidden := len(payloadLines) - ui.maxPayloadLines
+				payloadLines = append(payloadLines[:ui.maxPayloadLines],
+					ui.styles.Help.Render(fmt.Sprintf("… %d more lines", hidden)))
+			}
+			if truncated != "" {
+				payloadLines = append(payloadLines, ui.styles.Help.Render(truncated))
+			}
+			if note != "" {
+				payloadLines = append(payloadLines, ui.styles.Help.Render(note))
+			}
+			if msg.DecodeErr != "" {
+				payloadLines = append(payloadLines, ui.styles.Help.Render("transform failed: "+msg.DecodeErr))
+			}
 
 			messageContent := lipgloss.JoinVertical(
 				lipgloss.Left,
@@ -365,13 +1234,16 @@ func (ui *UI) renderMessagesPane(width, height int) string {
 			)
 
 			items = append(items, ui.styles.Message.Render(messageContent))
+			ui.recordMessageLines(items[len(items)-1], i)
 		}
-		
+
 		// Add scroll indicators
 		if ui.messageScroll > 0 {
 			title += " ↑"
 		}
-		if endIdx < len(ui.messages) {
+		if ui.newBelow > 0 {
+			title += fmt.Sprintf(" ↓ %d new", ui.newBelow)
+		} else if endIdx < len(visible) {
 			title += " ↓"
 		}
 	}
@@ -381,6 +1253,7 @@ func (ui *UI) renderMessagesPane(width, height int) string {
 	style := ui.styles.InactivePane
 	if ui.activePane == MessagesPane {
 		style = ui.styles.ActivePane
+		title = ui.activeTitle(title)
 	}
 
 	return style.
@@ -393,10 +1266,194 @@ func (ui *UI) renderMessagesPane(width, height int) string {
 		))
 }
 
+// renderTooSmall asks for a larger terminal in place of the panes
+func (ui *UI) renderTooSmall() string {
+	lines := []string{
+		"Terminal too small",
+		fmt.Sprintf("need at least %dx%d, have %dx%d", minTermWidth, minTermHeight, ui.width, ui.height),
+		"q quits",
+	}
+	for i, line := range lines {
+		lines[i] = runewidth.Truncate(line, ui.width, "…")
+	}
+	if len(lines) > ui.height {
+		lines = lines[:ui.height]
+	}
+	return ui.styles.Error.Render(strings.Join(lines, "\n"))
+}
+
+// messageMarker returns the two-column marker in front of a message: the
+// selection cursor and the bookmark star
+func (ui *UI) messageMarker(i int, msg Message) string {
+	cursor, star := " ", " "
+	if i == ui.selectedMessage && ui.activePane == MessagesPane {
+		cursor = "▶"
+	}
+	if _, ok := ui.bookmarks[msg.Seq]; ok {
+		star = "★"
+	} else if msg.Watched {
+		star = "!"
+	}
+	return ui.styles.MessageTopic.Render(cursor + star)
+}
+
+// activeTitle marks the active pane's title when there is no border color to do it
+func (ui *UI) activeTitle(title string) string {
+	if ui.minimal {
+		return "> " + title
+	}
+	return title
+}
+
+// messageColumns computes the column widths of the columnar layout: time,
+// topic, size and QoS are fixed, the payload takes what is left
+func messageColumns(width, timeWidth int) (topicWidth, payloadWidth int) {
+	fixed := timeWidth + 1 + 8 + 1 + 1 + 3 // time, size, QoS and separators
+	topicWidth = (width - fixed) / 3
+	if topicWidth < 10 {
+		topicWidth = 10
+	}
+	payloadWidth = width - fixed - topicWidth - 1
+	if payloadWidth < 10 {
+		payloadWidth = 10
+	}
+	return topicWidth, payloadWidth
+}
+
+// columnHeader renders the header row of the columnar layout
+func (ui *UI) columnHeader(width int) string {
+	topicWidth, payloadWidth := messageColumns(width, ui.timeWidth())
+	payload := "PAYLOAD"
+	if ui.jsonPathColumn(payloadWidth) {
+		payload = fmt.Sprintf("%-*s %s", jsonPathColumnWidth, runewidth.Truncate(strings.ToUpper(strings.Join(ui.jsonPath, ".")), jsonPathColumnWidth, "…"), payload)
+	}
+	return fmt.Sprintf("%-*s %-*s %8s %s  %s", ui.timeWidth(), "TIME", topicWidth, "TOPIC", "SIZE", "Q", payload)
+}
+
+// jsonPathColumnWidth is the width of the columnar layout's JSON path column
+const jsonPathColumnWidth = 12
+
+// jsonPathColumn reports whether the JSON path column is shown, which needs
+// a JSON path and room left for the payload
+func (ui *UI) jsonPathColumn(payloadWidth int) bool {
+	return ui.jsonPath != nil && payloadWidth > jsonPathColumnWidth+10
+}
+
+// renderMessageRow renders a message as a single aligned row
+func (ui *UI) renderMessageRow(msg Message, width int) string {
+	topicWidth, payloadWidth := messageColumns(width, ui.timeWidth())
+	topic := runewidth.FillRight(runewidth.Truncate(msg.Topic, topicWidth, "…"), topicWidth)
+	value := ""
+	if ui.jsonPathColumn(payloadWidth) {
+		payloadWidth -= jsonPathColumnWidth + 1
+		value = ui.styles.ActiveItem.Render(runewidth.FillRight(ui.jsonPathValue(msg, jsonPathColumnWidth), jsonPathColumnWidth)) + " "
+	}
+	data, binary, _, _ := ui.previewDecoded(msg)
+	payload := runewidth.Truncate(strings.Join(strings.Fields(sanitizePayload(string(data))), " "), payloadWidth, "…")
+	if image, ok := ui.imagePlaceholder(msg); ok {
+		payload = runewidth.Truncate(image, payloadWidth, "…")
+	} else if binary {
+		payload = hexBytes(data, payloadWidth)
+	} else {
+		payload = ui.highlightMatches(payload)
+	}
+
+	return ui.styles.MessageTime.Render(ui.formatTime(msg.Timestamp)) + " " +
+		ui.topicStyle(msg.Topic).Render(topic) + " " +
+		fmt.Sprintf("%8s %d%s ", formatBytes(len(msg.Payload)), msg.QoS, retainedFlag(msg)) +
+		value + payload
+}
+
+// retainedFlag marks retained messages in the columnar layout's QoS column
+func retainedFlag(msg Message) string {
+	if msg.Retained {
+		return "R"
+	}
+	return " "
+}
+
+// queuedDivider renders the line above a burst of messages queued during a
+// disconnect, starting at index start
+func (ui *UI) queuedDivider(start, width int) string {
+	count := 0
+	for i := start; i < len(ui.messages) && ui.messages[i].Queued; i++ {
+		count++
+	}
+	label := fmt.Sprintf(" %d messages queued during disconnect ", count)
+	side := (width - runewidth.StringWidth(label)) / 2
+	if side < 2 {
+		side = 2
+	}
+	return strings.Repeat("─", side) + label + strings.Repeat("─", side)
+}
+
+// displayPayload returns the transformed payload when there is one
+func displayPayload(msg Message) string {
+	if msg.Decoded != "" {
+		return msg.Decoded
+	}
+	return msg.Payload
+}
+
+// renderStatusBar renders the line below the panes: the broker, connection
+// state, client ID and how long the connection has been up
+func (ui *UI) renderStatusBar() string {
+	broker := ui.broker
+	if broker == "" {
+		broker = ui.brokerURL
+	}
+	parts := []string{ui.connStatus.String()}
+	if ui.connStatus != StatusNone {
+		parts = []string{broker, ui.connStatus.String(), "client " + ui.clientID}
+	}
+	if ui.connStatus == StatusConnected {
+		parts = append(parts, "up "+time.Since(ui.connectedAt).Truncate(time.Second).String())
+	}
+	if len(ui.throughput.samples) > 0 {
+		parts = append(parts, ui.throughput.summary())
+	}
+	return ui.styles.MessageTime.Render(runewidth.Truncate(strings.Join(parts, " • "), ui.width, "…"))
+}
+
 // renderHelp renders the help text
 func (ui *UI) renderHelp() string {
-	help := "↑/↓ navigate/scroll • tab switch panes • enter/space toggle subscription • r reset messages • q quit"
-	return ui.styles.Help.Render(help)
+	if ui.inputMode != NoInput {
+		return ui.input.View()
+	}
+	if ui.pendingSubscribe != nil {
+		return ui.styles.Error.Render(fmt.Sprintf("Subscribe to %d topics? (y/n)", len(ui.pendingSubscribe)))
+	}
+	if ui.pendingPublish != nil {
+		err := jsonPayloadError(ui.pendingPublish.Payload)
+		return ui.styles.Error.Render(fmt.Sprintf("Payload isn't valid JSON (%v). Send anyway? (y/n, e to edit)", err))
+	}
+	if ui.confirmingQuit {
+		return ui.styles.Error.Render(fmt.Sprintf("Save %d messages to %s before quitting? (y/n, esc to stay)", len(ui.messages), ui.exportFile))
+	}
+	if ui.confirmingReset {
+		prompt := fmt.Sprintf("Clear all %d messages? (y/n)", len(ui.messages))
+		if topic := ui.resetTarget(); topic != "" {
+			prompt = fmt.Sprintf("Clear %d messages on %s? (y/n)", len(ui.topicMessages(topic)), topic)
+		}
+		return ui.styles.Error.Render(prompt)
+	}
+
+	help := "↑/↓ navigate • tab switch panes • enter subscribe/inspect • / filter/search • s subscribe • p publish • i inspect • Q qos:%d • q quit • ? all keys"
+	return ui.styles.Help.Render(fmt.Sprintf(help, ui.subscribeQoS))
+}
+
+// formatBytes renders a byte count in human-readable units
+func formatBytes(n int) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := unit, 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
 }
 
 // wrapText wraps text to fit within the specified width
@@ -405,9 +1462,28 @@ func (ui *UI) wrapText(text string, width int) []string {
 		return []string{text}
 	}
 
-	words := strings.Fields(text)
+	// Wrap line by line so multi-line payloads such as indented JSON keep
+	// their line breaks and indentation
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		lines = append(lines, wrapLine(line, width)...)
+	}
+	return lines
+}
+
+// wrapLine word-wraps a single line to width, indenting continuation lines
+// like the first one
+func wrapLine(line string, width int) []string {
+	trimmed := strings.TrimLeft(line, " \t")
+	indent := strings.ReplaceAll(line[:len(line)-len(trimmed)], "\t", "  ")
+	if len(indent) > width/2 {
+		indent = indent[:width/2]
+	}
+	available := width - len(indent)
+
+	words := strings.Fields(trimmed)
 	if len(words) == 0 {
-		return []string{text}
+		return []string{""}
 	}
 
 	var lines []string
@@ -415,25 +1491,35 @@ func (ui *UI) wrapText(text string, width int) []string {
 	currentLength := 0
 
 	for _, word := range words {
-		if currentLength+len(word)+len(currentLine) > width {
-			if len(currentLine) > 0 {
-				lines = append(lines, strings.Join(currentLine, " "))
-				currentLine = []string{word}
-				currentLength = len(word)
-			} else {
-				// Word is too long, split it
-				lines = append(lines, word[:width])
-				currentLine = []string{}
-				currentLength = 0
-			}
-		} else {
+		wordWidth := runewidth.StringWidth(word)
+		if currentLength+wordWidth+len(currentLine) <= available {
 			currentLine = append(currentLine, word)
-			currentLength += len(word)
+			currentLength += wordWidth
+			continue
+		}
+		if len(currentLine) > 0 {
+			lines = append(lines, indent+strings.Join(currentLine, " "))
+			currentLine = nil
+			currentLength = 0
+		}
+		// Split words too long for a line of their own
+		for wordWidth > available {
+			head := runewidth.Truncate(word, available, "")
+			if head == "" {
+				break
+			}
+			lines = append(lines, indent+head)
+			word = word[len(head):]
+			wordWidth = runewidth.StringWidth(word)
+		}
+		if word != "" {
+			currentLine = []string{word}
+			currentLength = wordWidth
 		}
 	}
 
 	if len(currentLine) > 0 {
-		lines = append(lines, strings.Join(currentLine, " "))
+		lines = append(lines, indent+strings.Join(currentLine, " "))
 	}
 
 	return lines
@@ -443,6 +1529,7 @@ func (ui *UI) wrapText(text string, width int) []string {
 func (ui *UI) SetTopics(topics []string) {
 	sort.Strings(topics)
 	ui.topics = topics
+	ui.treeStale = true
 	if ui.selectedTopic >= len(topics) {
 		ui.selectedTopic = len(topics) - 1
 	}
@@ -452,29 +1539,392 @@ func (ui *UI) SetTopics(topics []string) {
 	ui.topicScroll = 0 // Reset scroll when topics change
 }
 
-// AddMessage adds a new message to the messages list
-func (ui *UI) AddMessage(topic, payload string, timestamp time.Time) {
-	message := Message{
-		Topic:     topic,
-		Payload:   payload,
-		Timestamp: timestamp,
+// AddTopic adds a single topic to the topic list if it isn't already there,
+// keeping the selected topic selected and in place on screen
+func (ui *UI) AddTopic(topic string) {
+	i := sort.SearchStrings(ui.topics, topic)
+	if i < len(ui.topics) && ui.topics[i] == topic {
+		return
+	}
+	var selected string
+	if keys := ui.topicKeys(); ui.selectedTopic >= 0 && ui.selectedTopic < len(keys) {
+		selected = keys[ui.selectedTopic]
+	}
+
+	ui.topics = append(ui.topics, "")
+	copy(ui.topics[i+1:], ui.topics[i:])
+	ui.topics[i] = topic
+	ui.treeStale = true
+
+	if selected == "" {
+		return
+	}
+	if j := slices.Index(ui.topicKeys(), selected); j >= 0 {
+		ui.topicScroll = max(0, ui.topicScroll+j-ui.selectedTopic)
+		ui.selectedTopic = j
+	}
+}
+
+// TopicsRemovedMsg asks the application to forget removed topics in
+// discovery, so they are listed again only if they show up again; All
+// forgets every topic and restarts discovery
+type TopicsRemovedMsg struct {
+	Topics []string
+	All    bool
+}
+
+// removeTopic drops a topic from the topics pane, unsubscribing from it if
+// subscribed; its messages stay
+func (ui *UI) removeTopic(topic string) tea.Cmd {
+	if i := sort.SearchStrings(ui.topics, topic); i < len(ui.topics) && ui.topics[i] == topic {
+		ui.topics = slices.Delete(ui.topics, i, i+1)
+		ui.treeStale = true
+	}
+	ui.explicitFilters = slices.DeleteFunc(ui.explicitFilters, func(filter string) bool { return filter == topic })
+	delete(ui.branchFilters, topic)
+	delete(ui.subscribedTopics, topic)
+	delete(ui.topicStats, topic)
+	ui.clampTopicSelection()
+	return tea.Batch(
+		func() tea.Msg { return TopicsRemovedMsg{Topics: []string{topic}} },
+		ui.FlashNotice("Removed "+topic),
+	)
+}
+
+// clearTopics empties the discovered topics list; subscriptions and typed
+// filters stay
+func (ui *UI) clearTopics() tea.Cmd {
+	ui.topics = []string{}
+	ui.treeStale = true
+	ui.selectedTopic = 0
+	ui.topicScroll = 0
+	notice := "Cleared topics, rediscovering"
+	if !ui.discovers {
+		notice = "Cleared topics"
 	}
+	return tea.Batch(
+		func() tea.Msg { return TopicsRemovedMsg{All: true} },
+		ui.FlashNotice(notice),
+	)
+}
 
+// clampTopicSelection keeps the selected topic within the listed topics
+func (ui *UI) clampTopicSelection() {
+	if n := len(ui.topicKeys()); ui.selectedTopic >= n {
+		ui.selectedTopic = n - 1
+	}
+	if ui.selectedTopic < 0 {
+		ui.selectedTopic = 0
+	}
+	if ui.topicScroll > ui.selectedTopic {
+		ui.topicScroll = ui.selectedTopic
+	}
+}
+
+// AddMessage adds a new message to the messages list and returns its sequence number
+func (ui *UI) AddMessage(message Message) uint64 {
+	// Follow new messages only while the newest visible one is selected
+	following := ui.atLatest()
+
+	ui.nextSeq++
+	message.Seq = ui.nextSeq
+	ui.noteWatched(&message)
 	ui.messages = append(ui.messages, message)
+	ui.addSearchMatch(len(ui.messages) - 1)
+	if ui.maxMessages > 0 && len(ui.messages) > ui.maxMessages {
+		ui.dropOldest(len(ui.messages) - ui.maxMessages)
+	}
 
-	// Auto-scroll to bottom for new messages (keep showing latest)
-	// Only auto-scroll if we're already at or near the bottom
-	if ui.activePane == MessagesPane || ui.messageScroll >= len(ui.messages)-5 {
-		ui.messageScroll = len(ui.messages) - 1
-		if ui.messageScroll < 0 {
-			ui.messageScroll = 0
+	stats, ok := ui.topicStats[message.Topic]
+	if !ok {
+		stats = &TopicStats{}
+		ui.topicStats[message.Topic] = stats
+	}
+	stats.Count++
+	stats.LastActivity = time.Now()
+	stats.rate.add(stats.LastActivity)
+	stats.LastSeen = message.Timestamp
+	stats.LastPayload = message.Payload
+	if value, ok := ui.numericPayload(message); ok {
+		stats.values.add(value)
+	}
+
+	// Auto-scroll to bottom for new messages (keep showing latest); when
+	// reading history, count what arrives below instead
+	if following && !ui.paused {
+		ui.scrollToLatest()
+	} else if ui.messageVisible(message) {
+		ui.newBelow++
+	}
+	return message.Seq
+}
+
+// AddMessages adds a batch of messages in order and returns their sequence numbers
+func (ui *UI) AddMessages(messages []Message) []uint64 {
+	seqs := make([]uint64, len(messages))
+	for i, message := range messages {
+		seqs[i] = ui.AddMessage(message)
+	}
+	return seqs
+}
+
+// togglePause freezes the messages pane at the current message or resumes
+// following new messages
+func (ui *UI) togglePause() {
+	ui.paused = !ui.paused
+	ui.invalidateSearch()
+	if ui.paused {
+		ui.pauseSeq = ui.nextSeq
+		return
+	}
+	ui.scrollToLatest()
+}
+
+// dropOldest removes the n oldest messages from the buffer, keeping the
+// selection and scroll position on the same messages
+func (ui *UI) dropOldest(n int) {
+	droppedVisible := 0
+	for _, msg := range ui.messages[:n] {
+		if ui.messageVisible(msg) {
+			droppedVisible++
+		}
+		delete(ui.filterMatches, msg.Seq)
+		delete(ui.pipelineCache.results, msg.Seq)
+	}
+
+	// Release the dropped payloads; the slice's backing array is reused until
+	// append reallocates it, which only copies the retained messages
+	clear(ui.messages[:n])
+	ui.messages = ui.messages[n:]
+	ui.dropSearchMatches(n)
+	ui.dropped += n
+
+	ui.selectedMessage = max(ui.selectedMessage-n, 0)
+	ui.messageScroll = max(ui.messageScroll-droppedVisible, 0)
+	if len(ui.bookmarks) > 0 {
+		ui.pruneBookmarks()
+	}
+}
+
+// dropExpired removes the messages at the head of the buffer that are older
+// than the message TTL
+func (ui *UI) dropExpired(now time.Time) {
+	if ui.messageTTL <= 0 {
+		return
+	}
+	cutoff := now.Add(-ui.messageTTL)
+	n := 0
+	for n < len(ui.messages) && ui.messages[n].Timestamp.Before(cutoff) {
+		n++
+	}
+	if n > 0 {
+		ui.dropOldest(n)
+	}
+}
+
+// SetDecoded attaches the result of an external transform to a message
+func (ui *UI) SetDecoded(seq uint64, output string, err error) {
+	i, ok := ui.messageIndex(seq)
+	if !ok {
+		return
+	}
+	if err != nil {
+		ui.messages[i].DecodeErr = err.Error()
+		return
+	}
+	ui.messages[i].Decoded = output
+	delete(ui.filterMatches, seq)
+	delete(ui.pipelineCache.results, seq)
+	ui.invalidateSearch()
+}
+
+// jumpToTop selects the first topic or the oldest message
+func (ui *UI) jumpToTop() {
+	if ui.activePane == TopicsPane {
+		ui.selectedTopic = 0
+		return
+	}
+	if i := ui.nextVisibleMessage(-1, 1); i >= 0 {
+		ui.selectedMessage = i
+	}
+}
+
+// pageSize returns how many topics or messages the active pane shows at once
+func (ui *UI) pageSize() int {
+	_, _, height := ui.paneLayout()
+	lines := height - 3 // Title and borders
+	if ui.activePane == MessagesPane && ui.columnar {
+		lines-- // Column header
+	}
+	return max(lines, 1)
+}
+
+// atLatest reports whether the newest visible message is selected
+func (ui *UI) atLatest() bool {
+	return ui.nextVisibleMessage(ui.selectedMessage, 1) < 0
+}
+
+// scrollToLatest selects the newest message and scrolls to it; rendering
+// clamps the position so the last page is filled
+func (ui *UI) scrollToLatest() {
+	ui.newBelow = 0
+	ui.selectedMessage = len(ui.messages) - 1
+	if ui.selectedMessage >= 0 && !ui.messageVisible(ui.messages[ui.selectedMessage]) {
+		if i := ui.nextVisibleMessage(ui.selectedMessage, -1); i >= 0 {
+			ui.selectedMessage = i
 		}
 	}
+	if ui.selectedMessage < 0 {
+		ui.selectedMessage = 0
+	}
+	ui.messageScroll = ui.selectedMessage
+}
+
+// SetBroker records the broker currently connected to, shown in the title
+func (ui *UI) SetBroker(broker string) {
+	ui.broker = broker
+}
+
+// SetConnectionStatus sets the connection state shown in the title; attempt
+// numbers the reconnection attempts
+func (ui *UI) SetConnectionStatus(status ConnectionStatus, attempt int) {
+	if status == StatusConnected && ui.connStatus != StatusConnected && ui.connStatus != StatusStalled {
+		ui.connectedAt = time.Now()
+	}
+	ui.connStatus = status
+	ui.reconnectAttempt = attempt
+}
+
+// ConnectionStatus returns the connection state shown in the title
+func (ui *UI) ConnectionStatus() ConnectionStatus {
+	return ui.connStatus
+}
+
+// noticeDuration is how long a flashed notice stays on screen
+const noticeDuration = 3 * time.Second
+
+// clearNoticeMsg clears a flashed notice unless another notice replaced it
+type clearNoticeMsg struct {
+	id int
+}
+
+// FlashNotice shows an informational message that clears itself after a moment
+func (ui *UI) FlashNotice(notice string) tea.Cmd {
+	ui.SetNotice(notice)
+	id := ui.noticeID
+	return tea.Tick(noticeDuration, func(time.Time) tea.Msg {
+		return clearNoticeMsg{id: id}
+	})
 }
 
-// SetError sets an error message
-func (ui *UI) SetError(err string) {
-	ui.error = err
+// SetNotice sets an informational message, shown when there is no error
+func (ui *UI) SetNotice(notice string) {
+	ui.noticeID++
+	ui.notice = notice
+}
+
+// SubscribeQoS returns the QoS new subscriptions are requested at
+func (ui *UI) SubscribeQoS() byte {
+	return ui.subscribeQoS
+}
+
+// SetTopicSubscribed marks a topic as subscribed or not without going
+// through the subscription toggle
+func (ui *UI) SetTopicSubscribed(topic string, subscribed bool) {
+	ui.subscribedTopics[topic] = subscribed
+}
+
+// bulkSubscribeConfirm is how many new subscriptions A makes before asking
+const bulkSubscribeConfirm = 200
+
+// subscribeAll subscribes to the topics listed in the topics pane, honoring
+// the topic filter
+func (ui *UI) subscribeAll() {
+	var topics []string
+	for _, topic := range ui.listedTopics() {
+		if !ui.subscribedTopics[topic] {
+			topics = append(topics, topic)
+		}
+	}
+	if len(topics) > bulkSubscribeConfirm {
+		ui.pendingSubscribe = topics
+		return
+	}
+	ui.subscribeTopics(topics)
+}
+
+// autoSubscribeTopics subscribes to newly discovered topics while
+// auto-subscribe is on, switching it off with a warning once it has made
+// autoSubscribeMax subscriptions
+func (ui *UI) autoSubscribeTopics(topics []string) {
+	for _, topic := range topics {
+		if !ui.autoSubscribe {
+			return
+		}
+		if ui.subscribedTopics[topic] {
+			continue
+		}
+		if ui.autoSubscribeMax > 0 && ui.autoSubscribed >= ui.autoSubscribeMax {
+			ui.autoSubscribe = false
+			ui.SetNotice(fmt.Sprintf("Warning: auto-subscribe stopped at %d topics; M resumes it", ui.autoSubscribeMax))
+			return
+		}
+		ui.subscribedTopics[topic] = true
+		ui.autoSubscribed++
+	}
+}
+
+// toggleAutoSubscribe switches auto-subscribe on or off; switching it on
+// starts a fresh count towards the cap
+func (ui *UI) toggleAutoSubscribe() tea.Cmd {
+	ui.autoSubscribe = !ui.autoSubscribe
+	if !ui.autoSubscribe {
+		return ui.FlashNotice("Auto-subscribe off")
+	}
+	ui.autoSubscribed = 0
+	return ui.FlashNotice("Auto-subscribe on: new topics are subscribed to as they are discovered")
+}
+
+// subscribeTopics marks topics as subscribed; the app diffs the change into
+// subscribe commands
+func (ui *UI) subscribeTopics(topics []string) {
+	for _, topic := range topics {
+		ui.subscribedTopics[topic] = true
+	}
+}
+
+// addExplicitSubscription subscribes to a typed topic filter and keeps it
+// listed in the topics pane, whatever discovery finds
+func (ui *UI) addExplicitSubscription(filter string) {
+	ui.addExplicitFilter(filter)
+	ui.subscribedTopics[filter] = true
+}
+
+// removeExplicitSubscription unsubscribes from a typed topic filter and
+// stops listing it
+func (ui *UI) removeExplicitSubscription(filter string) {
+	ui.explicitFilters = slices.DeleteFunc(ui.explicitFilters, func(f string) bool { return f == filter })
+	delete(ui.branchFilters, filter)
+	delete(ui.subscribedTopics, filter)
+	ui.clampTopicSelection()
+}
+
+// addExplicitFilter lists a typed topic filter in the topics pane without
+// subscribing to it
+func (ui *UI) addExplicitFilter(filter string) {
+	if !slices.Contains(ui.explicitFilters, filter) {
+		ui.explicitFilters = append(ui.explicitFilters, filter)
+		sort.Strings(ui.explicitFilters)
+	}
+}
+
+// RestoreSubscriptions puts back the subscriptions from GetSubscribedTopics,
+// undoing toggles that can't be carried out
+func (ui *UI) RestoreSubscriptions(topics []string) {
+	clear(ui.subscribedTopics)
+	for _, topic := range topics {
+		ui.subscribedTopics[topic] = true
+	}
 }
 
 // GetSubscribedTopics returns the list of subscribed topics
@@ -488,9 +1938,57 @@ func (ui *UI) GetSubscribedTopics() []string {
 	return subscribed
 }
 
+// listedTopics returns the topics shown in the topics pane: every discovered
+// topic, or only the active subscriptions when that view is toggled on,
+// narrowed by the topic filter
+func (ui *UI) listedTopics() []string {
+	return ui.filterTopics(ui.unfilteredTopics())
+}
+
+// unfilteredTopics returns the topics of the current view before the topic
+// filter is applied; explicit subscriptions come before the discovered topics
+func (ui *UI) unfilteredTopics() []string {
+	if !ui.showSubscribed {
+		if len(ui.explicitFilters) == 0 {
+			return ui.topics
+		}
+		listed := append([]string{}, ui.explicitFilters...)
+		for _, topic := range ui.topics {
+			if !slices.Contains(ui.explicitFilters, topic) {
+				listed = append(listed, topic)
+			}
+		}
+		return listed
+	}
+	subscribed := ui.GetSubscribedTopics()
+	sort.Strings(subscribed)
+	return subscribed
+}
+
+// subscriptionSummary describes a subscription's message count and last activity
+func (ui *UI) subscriptionSummary(topic string) string {
+	stats, ok := ui.topicStats[topic]
+	if !ok {
+		return "  0 msgs"
+	}
+	return fmt.Sprintf("  %d msgs, %s", stats.Count, stats.LastSeen.Format("15:04:05"))
+}
+
+// payloadPreview returns the topic's latest payload flattened to one line
+// and truncated to fit within width, including its leading separator
+func (ui *UI) payloadPreview(topic string, width int) string {
+	stats, ok := ui.topicStats[topic]
+	if !ok || width < 4 {
+		return ""
+	}
+	preview := strings.Join(strings.Fields(sanitizePayload(stats.LastPayload)), " ")
+	return "  " + runewidth.Truncate(preview, width-2, "…")
+}
+
 // updateTopicScroll adjusts the scroll position to keep the selected topic visible
 func (ui *UI) updateTopicScroll(visibleLines int) {
-	if len(ui.topics) == 0 {
+	topics := ui.topicKeys()
+	if len(topics) == 0 {
 		ui.topicScroll = 0
 		return
 	}
@@ -499,8 +1997,8 @@ func (ui *UI) updateTopicScroll(visibleLines int) {
 	if ui.selectedTopic < 0 {
 		ui.selectedTopic = 0
 	}
-	if ui.selectedTopic >= len(ui.topics) {
-		ui.selectedTopic = len(ui.topics) - 1
+	if ui.selectedTopic >= len(topics) {
+		ui.selectedTopic = len(topics) - 1
 	}
 
 	// Adjust scroll to keep selected topic visible
@@ -514,7 +2012,7 @@ func (ui *UI) updateTopicScroll(visibleLines int) {
 	if ui.topicScroll < 0 {
 		ui.topicScroll = 0
 	}
-	maxScroll := len(ui.topics) - visibleLines
+	maxScroll := len(topics) - visibleLines
 	if maxScroll < 0 {
 		maxScroll = 0
 	}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestMessagesBeforeFirstWindowSize(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages int
+	}{
+		{"fewer than a page", 3},
+		{"many pages", 200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ui := NewUI(Config{Theme: "dark"})
+			start := time.Now()
+			for i := range tt.messages {
+				ui.AddMessage(Message{
+					Topic:     "sensors/temp",
+					Payload:   fmt.Sprintf("payload-%03d", i),
+					Timestamp: start.Add(time.Duration(i) * time.Millisecond),
+				})
+			}
+			if view := ui.View(); view != "Initializing interface..." {
+				t.Fatalf("View before sizing = %q", view)
+			}
+
+			ui.Update(tea.WindowSizeMsg{Width: 120, Height: 30})
+			view := ui.View()
+
+			newest := fmt.Sprintf("payload-%03d", tt.messages-1)
+			if !strings.Contains(view, newest) {
+				t.Errorf("first render doesn't show the newest message %s", newest)
+			}
+			if ui.selectedMessage != tt.messages-1 {
+				t.Errorf("selected message %d, want the newest, %d", ui.selectedMessage, tt.messages-1)
+			}
+
+			// The last page is filled: scrolling any further down would leave
+			// blank lines, and the oldest message only shows when it fits
+			oldestShown := strings.Contains(view, "payload-000")
+			if tt.messages <= 10 {
+				if ui.messageScroll != 0 || !oldestShown {
+					t.Errorf("scroll %d with the oldest shown %t, want 0 and shown", ui.messageScroll, oldestShown)
+				}
+				return
+			}
+			if ui.messageScroll == 0 || oldestShown {
+				t.Errorf("scroll %d with the oldest shown %t, want the last page", ui.messageScroll, oldestShown)
+			}
+			shown := strings.Count(view, "payload-")
+			if ui.messageScroll+shown != tt.messages {
+				t.Errorf("scroll %d + %d shown doesn't end at message %d", ui.messageScroll, shown, tt.messages)
+			}
+		})
+	}
+}
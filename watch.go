@@ -0,0 +1,69 @@
+package main
+
+import (
+	"regexp"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// bellInterval is the least time between two bells, so a flood of matching
+// messages rings once rather than continuously
+const bellInterval = 2 * time.Second
+
+// bellDuration is how long the bell stays in the frame, long enough for the
+// renderer to flush at least one frame holding it
+const bellDuration = 100 * time.Millisecond
+
+// bellDoneMsg takes the bell back out of the frame
+type bellDoneMsg struct{}
+
+// watchPrompt is the prompt of the watch expression input
+const watchPrompt = "Watch (regex on topic or payload, empty to stop): "
+
+// compileWatch compiles the watch expression from the configuration; an
+// invalid one is logged and no messages are watched
+func compileWatch(expr string) *regexp.Regexp {
+	if expr == "" {
+		return nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		logError("Invalid value for MQTT_WATCH: %v, not watching", err)
+		return nil
+	}
+	return re
+}
+
+// watched reports whether a message matches the watch expression by topic
+// or payload
+func (ui *UI) watched(msg Message) bool {
+	return ui.watch != nil && (ui.watch.MatchString(msg.Topic) || ui.watch.MatchString(displayPayload(msg)))
+}
+
+// noteWatched flags a new message matching the watch expression and asks
+// for a bell unless one rang within bellInterval
+func (ui *UI) noteWatched(msg *Message) {
+	if !ui.watched(*msg) {
+		return
+	}
+	msg.Watched = true
+	if now := time.Now(); now.Sub(ui.lastBell) >= bellInterval {
+		ui.lastBell = now
+		ui.bellPending = true
+	}
+}
+
+// TakeBell rings the terminal bell when a watched message asked for one
+// since the last call. The bell is written as part of the frame, since the
+// renderer owns the terminal, and the returned command takes it out again.
+func (ui *UI) TakeBell() tea.Cmd {
+	if !ui.bellPending {
+		return nil
+	}
+	ui.bellPending = false
+	ui.bellRinging = true
+	return tea.Tick(bellDuration, func(time.Time) tea.Msg {
+		return bellDoneMsg{}
+	})
+}
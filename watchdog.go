@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// watchdogProbeTimeout is how long the broker gets to answer a probe
+const watchdogProbeTimeout = 10 * time.Second
+
+// watchdogMsg reports a watchdog check; Stalled is set when the broker
+// didn't answer a probe after a quiet spell of Quiet
+type watchdogMsg struct {
+	Stalled bool
+	Quiet   time.Duration
+}
+
+// noteActivity records that the broker just sent something
+func (m *MQTTClient) noteActivity() {
+	m.lastActivity.Store(time.Now().UnixNano())
+}
+
+// watchdogInterval is how often the watchdog checks, a quarter of the stall
+// timeout but at least every few seconds
+func (m *MQTTClient) watchdogInterval() time.Duration {
+	return max(m.config.StallTimeout/4, 5*time.Second)
+}
+
+// WatchdogCmd checks the connection after the watchdog interval. A broker
+// that has sent nothing for the stall timeout is probed with an unsubscribe
+// from a topic nobody uses, which it must acknowledge; no answer means the
+// link is stalled even though paho still thinks it is up. Quiet brokers
+// that answer the probe are fine.
+func (m *MQTTClient) WatchdogCmd() tea.Cmd {
+	return tea.Tick(m.watchdogInterval(), func(time.Time) tea.Msg {
+		if !m.IsConnected() {
+			return watchdogMsg{}
+		}
+		quiet := time.Since(time.Unix(0, m.lastActivity.Load()))
+		if quiet < m.config.StallTimeout {
+			return watchdogMsg{}
+		}
+		logDebug("No traffic for %s, probing the broker", quiet.Truncate(time.Second))
+		token := m.client.Unsubscribe(fmt.Sprintf("mqttui/watchdog/%s", m.config.ClientID))
+		if !token.WaitTimeout(watchdogProbeTimeout) {
+			logInfo("Broker didn't answer the watchdog probe after %s without traffic", quiet.Truncate(time.Second))
+			return watchdogMsg{Stalled: true, Quiet: quiet}
+		}
+		m.noteActivity()
+		return watchdogMsg{}
+	})
+}